@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/swanden/storage/pkg/cache"
 	"github.com/swanden/storage/pkg/conf"
 	"time"
 )
@@ -13,40 +14,112 @@ const (
 	defaultHandlerWorkerPoolSize        = 100
 	defaultMemcachedMaxIdleConns        = 10
 	defaultMemcachedMaxOpenConns        = 10
+	defaultMemcachedMaxWaiters          = 10_000
+	defaultMemcachedMinIdleConns        = 2
 	defaultMemcachedNewConnTimeout      = 3 * time.Second
 	defaultMemcachedDefaultRetryTimeout = 3000 * time.Millisecond
+	defaultMemcachedMaxIdleTime         = time.Minute
+	defaultMemcachedMaxConnLifetime     = 30 * time.Minute
+	defaultMemcachedHealthCheckIdle     = 5 * time.Second
+	defaultMemcachedKeepaliveInterval   = 30 * time.Second
+	defaultMemcachedListenerMaxKeySize  = 250
+	defaultMemcachedListenerMaxValSize  = 1024 * 1024
+	defaultStorageShutdownTimeout       = 5 * time.Second
+	defaultMemcachedBreakerMinRequests  = 10
+	defaultMemcachedBreakerWindow       = 10 * time.Second
+	defaultMemcachedBreakerOpenTimeout  = 5 * time.Second
+	defaultMemcachedBreakerHalfOpenReqs = 1
+	defaultCacheJanitorInterval         = time.Second
+	defaultCacheReportInterval          = time.Minute
+	defaultCacheAOFRewriteMinSize       = 64 << 20
 )
 
 type config struct {
 	ServiceName                 string
 	StorageType                 string
+	StorageShutdownTimeout      time.Duration
 	MemcachedHost               string
 	MemcachedPort               int
 	MemcachedMaxIdleConns       int
 	MemcachedMaxOpenConns       int
+	MemcachedMaxWaiters         int
+	MemcachedMinIdleConns       int
+	MemcachedWarmupTimeout      time.Duration
 	MemcachedNewConnTimeout     time.Duration
 	MemcachedConnRetryTimeout   time.Duration
+	MemcachedMaxIdleTime        time.Duration
+	MemcachedMaxConnLifetime    time.Duration
+	MemcachedHealthCheckIdle    time.Duration
+	MemcachedKeepaliveInterval  time.Duration
+	MemcachedBreakerRatio       float64
+	MemcachedBreakerMinRequests int
+	MemcachedBreakerWindow      time.Duration
+	MemcachedBreakerOpenTimeout time.Duration
+	MemcachedBreakerHalfOpen    int
+	MemcachedMultiplexedConns   int
+	CacheJanitorInterval        time.Duration
+	CacheMaxEntries             int
+	CacheMaxBytes               int
+	CachePolicy                 string
+	CacheShards                 int
+	CacheSnapshotFile           string
+	CacheSnapshotInterval       time.Duration
+	CacheAOFFile                string
+	CacheAOFFsync               string
+	CacheAOFRewriteMinSize      int
+	CacheReportInterval         time.Duration
 	LogLevel                    string
 	HandlerWorkerPoolSize       int
 	GRPCServerListenerPort      int
 	GRPCServerMaxRcvSize        int
 	GRPCServerTimeOutConnection time.Duration
+	MemcachedListenerPort       int
+	MemcachedListenerMaxKeySize int
+	MemcachedListenerMaxValSize int
 }
 
 func newConfig() config {
 	return config{
 		ServiceName:                 conf.StrValueRequired("SERVICE_NAME"),
 		StorageType:                 conf.StrValueRequired("STORAGE_TYPE"),
+		StorageShutdownTimeout:      conf.TimeDurValue("STORAGE_SHUTDOWN_TIMEOUT", defaultStorageShutdownTimeout),
 		MemcachedHost:               conf.StrValueRequired("MEMCACHED_HOST"),
 		MemcachedPort:               conf.IntValue("MEMCACHED_Port", defaultMemcachedPort),
 		MemcachedMaxIdleConns:       conf.IntValue("MEMCACHED_MAX_IDLE_CONNS", defaultMemcachedMaxIdleConns),
 		MemcachedMaxOpenConns:       conf.IntValue("MEMCACHED_MAX_OPEN_CONNS", defaultMemcachedMaxOpenConns),
+		MemcachedMaxWaiters:         conf.IntValue("MEMCACHED_MAX_WAITERS", defaultMemcachedMaxWaiters),
+		MemcachedMinIdleConns:       conf.IntValue("MEMCACHED_MIN_IDLE_CONNS", defaultMemcachedMinIdleConns),
+		MemcachedWarmupTimeout:      conf.TimeDurValue("MEMCACHED_WARMUP_TIMEOUT", 0),
 		MemcachedNewConnTimeout:     conf.TimeDurValue("MEMCACHED_NEW_CONN_TIMEOUT", defaultMemcachedNewConnTimeout),
 		MemcachedConnRetryTimeout:   conf.TimeDurValue("MEMCACHED_CONN_RETRY_TIMEOUT", defaultMemcachedDefaultRetryTimeout),
+		MemcachedMaxIdleTime:        conf.TimeDurValue("MEMCACHED_MAX_IDLE_TIME", defaultMemcachedMaxIdleTime),
+		MemcachedMaxConnLifetime:    conf.TimeDurValue("MEMCACHED_MAX_CONN_LIFETIME", defaultMemcachedMaxConnLifetime),
+		MemcachedHealthCheckIdle:    conf.TimeDurValue("MEMCACHED_HEALTH_CHECK_IDLE_THRESHOLD", defaultMemcachedHealthCheckIdle),
+		MemcachedKeepaliveInterval:  conf.TimeDurValue("MEMCACHED_KEEPALIVE_INTERVAL", defaultMemcachedKeepaliveInterval),
+		MemcachedBreakerRatio:       conf.FloatValue("MEMCACHED_BREAKER_FAILURE_RATIO", 0),
+		MemcachedBreakerMinRequests: conf.IntValue("MEMCACHED_BREAKER_MIN_REQUESTS", defaultMemcachedBreakerMinRequests),
+		MemcachedBreakerWindow:      conf.TimeDurValue("MEMCACHED_BREAKER_WINDOW", defaultMemcachedBreakerWindow),
+		MemcachedBreakerOpenTimeout: conf.TimeDurValue("MEMCACHED_BREAKER_OPEN_TIMEOUT", defaultMemcachedBreakerOpenTimeout),
+		MemcachedBreakerHalfOpen:    conf.IntValue("MEMCACHED_BREAKER_HALF_OPEN_REQUESTS", defaultMemcachedBreakerHalfOpenReqs),
+		MemcachedMultiplexedConns:   conf.IntValue("MEMCACHED_MULTIPLEXED_CONNS", 0),
+		CacheJanitorInterval:        conf.TimeDurValue("CACHE_JANITOR_INTERVAL", defaultCacheJanitorInterval),
+		CacheMaxEntries:             conf.IntValue("CACHE_MAX_ENTRIES", 0),
+		CacheMaxBytes:               conf.IntValue("CACHE_MAX_BYTES", 0),
+		CachePolicy:                 conf.StrValue("CACHE_POLICY", cache.PolicyLRU),
+		CacheShards:                 conf.IntValue("CACHE_SHARDS", 0),
+		CacheSnapshotFile:           conf.StrValue("CACHE_SNAPSHOT_FILE", ""),
+		CacheSnapshotInterval:       conf.TimeDurValue("CACHE_SNAPSHOT_INTERVAL", 0),
+		CacheAOFFile:                conf.StrValue("CACHE_AOF_FILE", ""),
+		CacheAOFFsync:               conf.StrValue("CACHE_AOF_FSYNC", "everysec"),
+		CacheAOFRewriteMinSize:      conf.IntValue("CACHE_AOF_REWRITE_MIN_SIZE", defaultCacheAOFRewriteMinSize),
+		CacheReportInterval:         conf.TimeDurValue("CACHE_REPORT_INTERVAL", defaultCacheReportInterval),
 		LogLevel:                    conf.StrValue("LOG_LEVEL", "info"),
 		HandlerWorkerPoolSize:       conf.IntValue("HANDLER_WP_SIZE", defaultHandlerWorkerPoolSize),
 		GRPCServerListenerPort:      conf.IntValue("GRPC_SERVER_LISTENER_PORT", defaultGRPCListenerPort),
 		GRPCServerMaxRcvSize:        conf.IntValue("GRPC_SERVER_MAX_RECIVE_SIZE", defaultGRPCMAXRcv),
 		GRPCServerTimeOutConnection: conf.TimeDurValue("GRPC_SERVER_TIME_OUT_CONNECTION", defaultGRPCTimeOutConnection),
+		MemcachedListenerPort:       conf.IntValue("MEMCACHED_LISTENER_PORT", 0),
+		MemcachedListenerMaxKeySize: conf.IntValue("MEMCACHED_LISTENER_MAX_KEY_SIZE", defaultMemcachedListenerMaxKeySize),
+		MemcachedListenerMaxValSize: conf.IntValue("MEMCACHED_LISTENER_MAX_VALUE_SIZE", defaultMemcachedListenerMaxValSize),
 	}
 }
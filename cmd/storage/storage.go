@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"github.com/swanden/storage/internal/adapters"
 	storageController "github.com/swanden/storage/internal/controller/grpc/storage"
+	memcachedController "github.com/swanden/storage/internal/controller/memcached/storage"
 	storageUseCase "github.com/swanden/storage/internal/usecase/storage"
 	"github.com/swanden/storage/pkg/cache"
 	"github.com/swanden/storage/pkg/interceptors"
 	"github.com/swanden/storage/pkg/logger"
 	"github.com/swanden/storage/pkg/memcached"
+	"github.com/swanden/storage/pkg/pool"
 	"google.golang.org/grpc"
 	"net"
 	"os"
@@ -29,7 +31,11 @@ type Storage interface {
 	Set(ctx context.Context, key, value string, ttl time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
 	Delete(ctx context.Context, key string) error
+	Incr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Decr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Flush(ctx context.Context) error
 	Close()
+	Shutdown(ctx context.Context) error
 }
 
 func main() {
@@ -51,26 +57,105 @@ func main() {
 
 	var storage Storage
 	if cfg.StorageType == storageTypeMemcached {
-		memcachedClient, err := memcached.Connect(
-			cfg.MemcachedHost,
+		memcachedOpts := []memcached.Option{
 			memcached.WithPort(cfg.MemcachedPort),
 			memcached.WithMaxIdleConns(cfg.MemcachedMaxIdleConns),
 			memcached.WithMaxOpenConns(cfg.MemcachedMaxOpenConns),
+			memcached.WithMinIdleConns(cfg.MemcachedMinIdleConns),
+			memcached.WithMaxWaiters(cfg.MemcachedMaxWaiters),
 			memcached.WithNewConnTimeout(cfg.MemcachedNewConnTimeout),
 			memcached.WithConnRetryTimeout(cfg.MemcachedConnRetryTimeout),
-		)
+			memcached.WithMaxIdleTime(cfg.MemcachedMaxIdleTime),
+			memcached.WithMaxConnLifetime(cfg.MemcachedMaxConnLifetime),
+			memcached.WithHealthCheckIdleThreshold(cfg.MemcachedHealthCheckIdle),
+			memcached.WithKeepaliveInterval(cfg.MemcachedKeepaliveInterval),
+			memcached.WithCircuitBreaker(cfg.MemcachedBreakerRatio, cfg.MemcachedBreakerMinRequests, cfg.MemcachedBreakerWindow),
+			memcached.WithCircuitBreakerRecovery(cfg.MemcachedBreakerOpenTimeout, cfg.MemcachedBreakerHalfOpen),
+			memcached.WithMultiplexedConns(cfg.MemcachedMultiplexedConns),
+			memcached.WithCircuitBreakerStateHook(func(from, to pool.BreakerState) {
+				loggerInst.Info().
+					Str("from", from.String()).
+					Str("to", to.String()).
+					Msg("Memcached circuit breaker state changed")
+			}),
+		}
+		if cfg.MemcachedWarmupTimeout > 0 {
+			warmupCtx, warmupCancel := context.WithTimeout(ctx, cfg.MemcachedWarmupTimeout)
+			defer warmupCancel()
+
+			memcachedOpts = append(memcachedOpts, memcached.WithWarmup(warmupCtx))
+		}
+
+		memcachedClient, err := memcached.Connect(cfg.MemcachedHost, memcachedOpts...)
 		if err != nil {
-			loggerInst.Error().Err(err).Msg("Unable to create memcached client")
+			loggerInst.Fatal().Err(err).Msg("Unable to create memcached client")
 		}
 
 		memcachedAdapter := adapters.NewMemcachedAdapter(memcachedClient)
 		storage = memcachedAdapter
 	} else {
-		cacheInst := cache.New()
+		cachePolicy, err := cache.ParsePolicy(cfg.CachePolicy)
+		if err != nil {
+			loggerInst.Fatal().Err(err).Msg("Unable to create cache")
+		}
+
+		cacheOpts := []cache.Option{
+			cache.WithJanitorInterval(cfg.CacheJanitorInterval),
+			cache.WithMaxEntries(cfg.CacheMaxEntries),
+			cache.WithMaxBytes(int64(cfg.CacheMaxBytes)),
+			cache.WithPolicy(cachePolicy),
+		}
+		if cfg.CacheShards > 0 {
+			cacheOpts = append(cacheOpts, cache.WithShards(cfg.CacheShards))
+		}
+		if cfg.CacheSnapshotFile != "" {
+			cacheOpts = append(cacheOpts,
+				cache.WithSnapshotFile(cfg.CacheSnapshotFile),
+				cache.WithSnapshotInterval(cfg.CacheSnapshotInterval),
+				cache.WithSnapshotErrorHandler(func(err error) {
+					loggerInst.Error().Err(err).Msg("Unable to write cache snapshot")
+				}),
+			)
+		}
+
+		if cfg.CacheAOFFile != "" {
+			aofFsync, err := cache.ParseFsyncPolicy(cfg.CacheAOFFsync)
+			if err != nil {
+				loggerInst.Fatal().Err(err).Msg("Unable to create cache")
+			}
+
+			cacheOpts = append(cacheOpts,
+				cache.WithAOFFile(cfg.CacheAOFFile),
+				cache.WithAOFFsync(aofFsync),
+				cache.WithAOFRewriteMinSize(int64(cfg.CacheAOFRewriteMinSize)),
+				cache.WithAOFErrorHandler(func(err error) {
+					loggerInst.Error().Err(err).Msg("Unable to write cache append-only log")
+				}),
+			)
+		}
+
+		cacheInst := cache.New(cacheOpts...)
+
+		// the append-only log has every change, so the snapshot is loaded only without it
+		if cfg.CacheAOFFile != "" {
+			if err := cacheInst.OpenAOF(); err != nil {
+				loggerInst.Fatal().Err(err).Msg("Unable to open cache append-only log")
+			}
+		} else if cfg.CacheSnapshotFile != "" {
+			if err := cacheInst.LoadSnapshot(); err != nil {
+				loggerInst.Fatal().Err(err).Msg("Unable to load cache snapshot")
+			}
+		}
+		if cfg.CacheSnapshotFile != "" {
+			go snapshotOnSignal(ctx, loggerInst, cacheInst)
+		}
 		cacheAdapter := adapters.NewCacheAdapter(cacheInst)
 		storage = cacheAdapter
+
+		if cfg.CacheReportInterval > 0 {
+			go reportCacheStats(ctx, loggerInst, cacheAdapter, cfg.CacheReportInterval)
+		}
 	}
-	defer storage.Close()
 
 	storageUseCaseInst, err := storageUseCase.New(
 		storageUseCase.WithLogger(loggerInst),
@@ -108,6 +193,33 @@ func main() {
 		}
 	}()
 
+	var serverMemcached *memcachedController.Server
+	if cfg.MemcachedListenerPort > 0 {
+		serverMemcached, err = memcachedController.New(
+			memcachedController.WithLogger(loggerInst),
+			memcachedController.WithStorageUseCase(storageUseCaseInst),
+			memcachedController.WithMaxKeySize(cfg.MemcachedListenerMaxKeySize),
+			memcachedController.WithMaxValueSize(cfg.MemcachedListenerMaxValSize),
+		)
+		if err != nil {
+			loggerInst.Fatal().Err(err).Msg("Unable to create memcached server")
+		}
+
+		serverMemcachedLis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.MemcachedListenerPort))
+		if err != nil {
+			loggerInst.Fatal().Err(err).Msg("Unable to listen TCP for memcached server")
+		}
+
+		go func() {
+			loggerInst.Info().Msg("Memcached server start")
+
+			if err := serverMemcached.Serve(serverMemcachedLis); err != nil {
+				loggerInst.Error().Err(err).Msg("Got memcached server listener error")
+				cancel()
+			}
+		}()
+	}
+
 	loggerInst.Info().
 		Str("name", cfg.ServiceName).
 		Msg("Service started")
@@ -120,8 +232,72 @@ func main() {
 		Str("name", cfg.ServiceName).
 		Msg("Service shutdown")
 
+	if serverMemcached != nil {
+		serverMemcached.Stop()
+	}
+
 	serverGRPC.GracefulStop()
 	serverGRPC.Stop()
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.StorageShutdownTimeout)
+	defer shutdownCancel()
+
+	if err := storage.Shutdown(shutdownCtx); err != nil {
+		loggerInst.Error().Err(err).Msg("Unable to shutdown storage gracefully")
+	}
+}
+
+// reportCacheStats logs cache hit ratio, evictions and size when the cache was used since the last report
+func reportCacheStats(ctx context.Context, loggerInst *logger.Logger, cacheAdapter *adapters.CacheAdapter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var reported cache.Stats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := cacheAdapter.Stats()
+			if stats == reported {
+				continue
+			}
+
+			loggerInst.Info().
+				Uint64("hits", stats.Hits).
+				Uint64("misses", stats.Misses).
+				Uint64("expired_on_read", stats.ExpiredOnRead).
+				Float64("hit_ratio", stats.HitRatio()).
+				Uint64("evictions", stats.Evictions).
+				Uint64("sets", stats.Sets).
+				Uint64("deletes", stats.Deletes).
+				Int("entries", stats.Entries).
+				Int64("bytes", stats.Bytes).
+				Msg("Cache stats")
+			reported = stats
+		}
+	}
+}
+
+// snapshotOnSignal writes cache snapshot on demand when SIGUSR1 is received
+func snapshotOnSignal(ctx context.Context, loggerInst *logger.Logger, cacheInst *cache.Cache) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			if err := cacheInst.Snapshot(); err != nil {
+				loggerInst.Error().Err(err).Msg("Unable to write cache snapshot")
+				continue
+			}
+
+			loggerInst.Info().Msg("Cache snapshot written")
+		}
+	}
 }
 
 func newOSSignalContext(ctx context.Context) context.Context {
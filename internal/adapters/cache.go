@@ -2,7 +2,9 @@ package adapters
 
 import (
 	"context"
+	"github.com/pkg/errors"
 	"github.com/swanden/storage/pkg/cache"
+	"strconv"
 	"time"
 )
 
@@ -37,5 +39,77 @@ func (ca *CacheAdapter) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// Incr adds delta to the numeric value of the key like memcached does, the result wraps
+// around at 64 bits and the item keeps its ttl
+func (ca *CacheAdapter) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return ca.add(key, func(n uint64) uint64 {
+		return n + delta
+	})
+}
+
+// Decr subtracts delta from the numeric value of the key like memcached does, the result
+// doesn't go below 0 and the item keeps its ttl
+func (ca *CacheAdapter) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return ca.add(key, func(n uint64) uint64 {
+		if delta > n {
+			return 0
+		}
+
+		return n - delta
+	})
+}
+
+// add replaces the numeric value of the key with the result of fn under the lock of the key,
+// a value which is not a number is stored back unchanged
+func (ca *CacheAdapter) add(key string, fn func(uint64) uint64) (uint64, error) {
+	var n uint64
+	var err error
+
+	_, found := ca.cache.Update(key, func(value string, ok bool) (string, bool) {
+		if !ok {
+			return value, false
+		}
+
+		if n, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return value, true
+		}
+
+		n = fn(n)
+
+		return strconv.FormatUint(n, 10), true
+	})
+	if !found {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, ErrNotNumeric
+	}
+
+	return n, nil
+}
+
+func (ca *CacheAdapter) Flush(ctx context.Context) error {
+	ca.cache.Flush()
+
+	return nil
+}
+
+// Stats returns cache hit, miss and eviction counters with its size
+func (ca *CacheAdapter) Stats() cache.Stats {
+	return ca.cache.Stats()
+}
+
 func (ca *CacheAdapter) Close() {
+	ca.cache.Close()
+}
+
+// Shutdown stops background jobs of the cache and writes the final snapshot if it's configured
+func (ca *CacheAdapter) Shutdown(ctx context.Context) error {
+	ca.cache.Close()
+
+	if err := ca.cache.Snapshot(); err != nil && !errors.Is(err, cache.ErrSnapshotDisabled) {
+		return err
+	}
+
+	return nil
 }
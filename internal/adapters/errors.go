@@ -3,5 +3,6 @@ package adapters
 import "github.com/pkg/errors"
 
 var (
-	ErrNotFound = errors.New("memcached adapter: key not found")
+	ErrNotFound   = errors.New("memcached adapter: key not found")
+	ErrNotNumeric = errors.New("adapter: value is not a number")
 )
@@ -34,6 +34,33 @@ func (ma *MemcachedAdapter) Delete(ctx context.Context, key string) error {
 	return ma.client.Delete(ctx, key)
 }
 
+func (ma *MemcachedAdapter) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return ma.incrResult(ma.client.Incr(ctx, key, delta))
+}
+
+func (ma *MemcachedAdapter) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return ma.incrResult(ma.client.Decr(ctx, key, delta))
+}
+
+func (ma *MemcachedAdapter) incrResult(value uint64, err error) (uint64, error) {
+	switch {
+	case errors.Is(err, memcached.ErrNotFound):
+		return 0, ErrNotFound
+	case errors.Is(err, memcached.ErrNotNumeric):
+		return 0, ErrNotNumeric
+	}
+
+	return value, err
+}
+
+func (ma *MemcachedAdapter) Flush(ctx context.Context) error {
+	return ma.client.FlushAll(ctx)
+}
+
 func (ma *MemcachedAdapter) Close() {
 	ma.client.Close()
 }
+
+func (ma *MemcachedAdapter) Shutdown(ctx context.Context) error {
+	return ma.client.Shutdown(ctx)
+}
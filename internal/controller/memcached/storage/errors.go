@@ -0,0 +1,12 @@
+package storage
+
+import "github.com/pkg/errors"
+
+var (
+	ErrBadLogger         = errors.New("memcached controller: bad logger implementation")
+	ErrBadStorageUseCase = errors.New("memcached controller: bad storage use case implementation")
+	ErrBadMaxKeySize     = errors.New("memcached controller: max key size must be greater than 0")
+	ErrBadMaxValueSize   = errors.New("memcached controller: max value size must be greater than 0")
+	ErrServerClosed      = errors.New("memcached controller: server closed")
+	ErrLineTooLong       = errors.New("memcached controller: command line too long")
+)
@@ -0,0 +1,78 @@
+package storage
+
+const (
+	defaultMaxKeySize   = 250
+	defaultMaxValueSize = 1024 * 1024
+)
+
+type Options func(*options) error
+
+type options struct {
+	log            Logger
+	storageUseCase StorageUseCase
+	maxKeySize     int
+	maxValueSize   int
+}
+
+func getDefaultOptions() options {
+	return options{
+		log:            nil,
+		storageUseCase: nil,
+		maxKeySize:     defaultMaxKeySize,
+		maxValueSize:   defaultMaxValueSize,
+	}
+}
+
+func validate(opts options) error {
+	if opts.log == nil {
+		return ErrBadLogger
+	}
+
+	if opts.storageUseCase == nil {
+		return ErrBadStorageUseCase
+	}
+
+	if opts.maxKeySize <= 0 {
+		return ErrBadMaxKeySize
+	}
+
+	if opts.maxValueSize <= 0 {
+		return ErrBadMaxValueSize
+	}
+
+	return nil
+}
+
+func WithLogger(logger Logger) Options {
+	return func(o *options) error {
+		o.log = logger
+
+		return nil
+	}
+}
+
+func WithStorageUseCase(storageUseCase StorageUseCase) Options {
+	return func(o *options) error {
+		o.storageUseCase = storageUseCase
+
+		return nil
+	}
+}
+
+// WithMaxKeySize sets max key length in bytes, memcached uses 250
+func WithMaxKeySize(maxKeySize int) Options {
+	return func(o *options) error {
+		o.maxKeySize = maxKeySize
+
+		return nil
+	}
+}
+
+// WithMaxValueSize sets max value length in bytes, memcached uses 1MB
+func WithMaxValueSize(maxValueSize int) Options {
+	return func(o *options) error {
+		o.maxValueSize = maxValueSize
+
+		return nil
+	}
+}
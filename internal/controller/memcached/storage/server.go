@@ -0,0 +1,783 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	storageUseCase "github.com/swanden/storage/internal/usecase/storage"
+	"github.com/swanden/storage/pkg/logger"
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	method         = "method"
+	requestUUIDKey = "requestUUID"
+
+	version       = "1.6.0"
+	eol           = "\r\n"
+	maxLineLength = 16 * 1024
+	// exptime greater than 30 days is treated by memcached as unix timestamp
+	maxRelativeExptime = 60 * 60 * 24 * 30
+	// keyLocks is the number of locks writes to keys are spread over
+	keyLocks = 256
+
+	responseError         = "ERROR"
+	responseStored        = "STORED"
+	responseNotStored     = "NOT_STORED"
+	responseExists        = "EXISTS"
+	responseNotFound      = "NOT_FOUND"
+	responseDeleted       = "DELETED"
+	responseTouched       = "TOUCHED"
+	responseOK            = "OK"
+	responseEnd           = "END"
+	responseBadFormat     = "CLIENT_ERROR bad command line format"
+	responseBadChunk      = "CLIENT_ERROR bad data chunk"
+	responseLineTooLong   = "CLIENT_ERROR line too long"
+	responseBadDelta      = "CLIENT_ERROR invalid numeric delta argument"
+	responseNonNumeric    = "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	responseTooLarge      = "SERVER_ERROR object too large for cache"
+	responseStorageFailed = "SERVER_ERROR storage failure"
+)
+
+type Logger interface {
+	Debug() logger.Event
+	Info() logger.Event
+	Error() logger.Event
+}
+
+type StorageUseCase interface {
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
+	Delete(ctx context.Context, key string) error
+	Incr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Decr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Flush(ctx context.Context) error
+}
+
+type stats struct {
+	totalConns   atomic.Uint64
+	cmdGet       atomic.Uint64
+	cmdSet       atomic.Uint64
+	cmdTouch     atomic.Uint64
+	cmdFlush     atomic.Uint64
+	getHits      atomic.Uint64
+	getMisses    atomic.Uint64
+	deleteHits   atomic.Uint64
+	deleteMisses atomic.Uint64
+	incrHits     atomic.Uint64
+	incrMisses   atomic.Uint64
+	decrHits     atomic.Uint64
+	decrMisses   atomic.Uint64
+	casHits      atomic.Uint64
+	casMisses    atomic.Uint64
+	casBadVal    atomic.Uint64
+	touchHits    atomic.Uint64
+	touchMisses  atomic.Uint64
+}
+
+// Server serves memcached text protocol on top of the storage use case.
+//
+// Storage keeps only values, so flags are validated but not stored and always
+// returned as 0 and cas unique is a hash of the value. All writes to a key
+// are serialized by the server with a lock of the key, so commands which read
+// the key before writing it are atomic against other memcached protocol clients,
+// but not against writes through other APIs of the storage. incr and decr are done
+// by the storage and keep the remaining ttl of the key.
+type Server struct {
+	log            Logger
+	storageUseCase StorageUseCase
+	maxKeySize     int
+	maxValueSize   int
+
+	// keyMu are locks of keys, a key takes the lock of its hash
+	keyMu [keyLocks]sync.Mutex
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+
+	startTime time.Time
+	stats     stats
+}
+
+func New(options ...Options) (*Server, error) {
+	opts := getDefaultOptions()
+
+	for _, opt := range options {
+		if opt != nil {
+			if err := opt(&opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := validate(opts); err != nil {
+		return nil, err
+	}
+
+	return &Server{
+		log:            opts.log,
+		storageUseCase: opts.storageUseCase,
+		maxKeySize:     opts.maxKeySize,
+		maxValueSize:   opts.maxValueSize,
+		conns:          make(map[net.Conn]struct{}),
+		startTime:      time.Now(),
+	}, nil
+}
+
+// Serve accepts connections on the listener until Stop is called.
+// Serve returns nil after Stop, like grpc.Server does.
+func (s *Server) Serve(lis net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		lis.Close()
+		return ErrServerClosed
+	}
+	s.listener = lis
+	s.mu.Unlock()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return nil
+			}
+
+			return err
+		}
+
+		if !s.addConn(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Stop closes the listener and all client connections and waits for
+// in-flight commands to finish
+func (s *Server) Stop() {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+func (s *Server) addConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	s.stats.totalConns.Add(1)
+
+	return true
+}
+
+func (s *Server) removeConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	conn.Close()
+	s.wg.Done()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.removeConn(conn)
+
+	s.log.Debug().
+		Str(method, "[MemcachedController] [Serve]").
+		Str("remote", conn.RemoteAddr().String()).
+		Msg("connection opened")
+	defer s.log.Debug().
+		Str(method, "[MemcachedController] [Serve]").
+		Str("remote", conn.RemoteAddr().String()).
+		Msg("connection closed")
+
+	r := bufio.NewReaderSize(conn, maxLineLength)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := readLine(r)
+		if errors.Is(err, ErrLineTooLong) {
+			writeLine(w, responseLineTooLong)
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		quit, err := s.handle(r, w, line)
+		if err != nil {
+			return
+		}
+
+		if quit || r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+
+		if quit {
+			return
+		}
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", ErrLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	return string(line), nil
+}
+
+func writeLine(w *bufio.Writer, line string) {
+	w.WriteString(line)
+	w.WriteString(eol)
+}
+
+func reply(w *bufio.Writer, noreply bool, line string) {
+	if noreply {
+		return
+	}
+
+	writeLine(w, line)
+}
+
+// handle executes one command, it returns an error only when the
+// connection can't be used anymore
+func (s *Server) handle(r *bufio.Reader, w *bufio.Writer, line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		writeLine(w, responseError)
+		return false, nil
+	}
+
+	ctx := context.WithValue(context.Background(), requestUUIDKey, uuid.NewV4().String())
+
+	command, args := fields[0], fields[1:]
+
+	switch command {
+	case "get":
+		s.get(ctx, w, args, false)
+	case "gets":
+		s.get(ctx, w, args, true)
+	case "set", "add", "replace", "cas":
+		return false, s.store(ctx, r, w, command, args)
+	case "delete":
+		s.delete(ctx, w, args)
+	case "incr", "decr":
+		s.incr(ctx, w, command, args)
+	case "touch":
+		s.touch(ctx, w, args)
+	case "flush_all":
+		s.flushAll(ctx, w, args)
+	case "version":
+		writeLine(w, "VERSION "+version)
+	case "stats":
+		s.writeStats(w, args)
+	case "quit":
+		return true, nil
+	default:
+		writeLine(w, responseError)
+	}
+
+	return false, nil
+}
+
+func (s *Server) get(ctx context.Context, w *bufio.Writer, keys []string, withCAS bool) {
+	if len(keys) == 0 {
+		writeLine(w, responseError)
+		return
+	}
+
+	for _, key := range keys {
+		if !s.validKey(key) {
+			writeLine(w, responseBadFormat)
+			return
+		}
+	}
+
+	for _, key := range keys {
+		s.stats.cmdGet.Add(1)
+
+		value, found, err := s.lookup(ctx, key)
+		if err != nil {
+			s.serverError(ctx, w, "[MemcachedController] [Get]", key, err)
+			return
+		}
+		if !found {
+			s.stats.getMisses.Add(1)
+			continue
+		}
+		s.stats.getHits.Add(1)
+
+		if withCAS {
+			fmt.Fprintf(w, "VALUE %s 0 %d %d%s", key, len(value), casUnique(value), eol)
+		} else {
+			fmt.Fprintf(w, "VALUE %s 0 %d%s", key, len(value), eol)
+		}
+		writeLine(w, value)
+	}
+
+	writeLine(w, responseEnd)
+}
+
+// store handles set, add, replace and cas: <command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+func (s *Server) store(ctx context.Context, r *bufio.Reader, w *bufio.Writer, command string, args []string) error {
+	argsCount := 4
+	if command == "cas" {
+		argsCount = 5
+	}
+
+	noreply, ok := parseNoreply(args, argsCount)
+	if !ok {
+		writeLine(w, responseError)
+		return nil
+	}
+
+	key := args[0]
+	_, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, exptimeErr := strconv.ParseInt(args[2], 10, 64)
+	size, sizeErr := strconv.Atoi(args[3])
+	if flagsErr != nil || exptimeErr != nil || sizeErr != nil || size < 0 {
+		writeLine(w, responseBadFormat)
+		return nil
+	}
+
+	var unique uint64
+	if command == "cas" {
+		var err error
+		if unique, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+			writeLine(w, responseBadFormat)
+			return nil
+		}
+	}
+
+	if size > s.maxValueSize {
+		if _, err := io.CopyN(io.Discard, r, int64(size+len(eol))); err != nil {
+			return err
+		}
+		reply(w, noreply, responseTooLarge)
+		return nil
+	}
+
+	data := make([]byte, size+len(eol))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(data, []byte(eol)) {
+		reply(w, noreply, responseBadChunk)
+		return nil
+	}
+
+	if !s.validKey(key) {
+		reply(w, noreply, responseBadFormat)
+		return nil
+	}
+
+	value := string(data[:size])
+	ttl, alive := ttlFromExptime(exptime)
+
+	s.stats.cmdSet.Add(1)
+
+	mu := s.lockKey(key)
+	defer mu.Unlock()
+
+	if command != "set" {
+		current, found, err := s.lookup(ctx, key)
+		if err != nil {
+			s.serverError(ctx, w, "[MemcachedController] [Store]", key, err)
+			return nil
+		}
+
+		switch {
+		case command == "add" && found, command == "replace" && !found:
+			reply(w, noreply, responseNotStored)
+			return nil
+		case command == "cas" && !found:
+			s.stats.casMisses.Add(1)
+			reply(w, noreply, responseNotFound)
+			return nil
+		case command == "cas" && casUnique(current) != unique:
+			s.stats.casBadVal.Add(1)
+			reply(w, noreply, responseExists)
+			return nil
+		case command == "cas":
+			s.stats.casHits.Add(1)
+		}
+	}
+
+	if err := s.put(ctx, key, value, ttl, alive); err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [Store]", key, err)
+		return nil
+	}
+
+	reply(w, noreply, responseStored)
+
+	return nil
+}
+
+// delete handles delete <key> [0] [noreply], zero time is accepted for old clients
+func (s *Server) delete(ctx context.Context, w *bufio.Writer, args []string) {
+	if len(args) == 3 || (len(args) == 2 && args[1] != "noreply") {
+		if args[1] != "0" {
+			writeLine(w, "CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]")
+			return
+		}
+		args = append(args[:1], args[2:]...)
+	}
+
+	noreply, ok := parseNoreply(args, 1)
+	if !ok {
+		writeLine(w, responseError)
+		return
+	}
+
+	key := args[0]
+	if !s.validKey(key) {
+		reply(w, noreply, responseBadFormat)
+		return
+	}
+
+	mu := s.lockKey(key)
+	defer mu.Unlock()
+
+	_, found, err := s.lookup(ctx, key)
+	if err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [Delete]", key, err)
+		return
+	}
+	if !found {
+		s.stats.deleteMisses.Add(1)
+		reply(w, noreply, responseNotFound)
+		return
+	}
+
+	if err := s.storageUseCase.Delete(ctx, key); err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [Delete]", key, err)
+		return
+	}
+	s.stats.deleteHits.Add(1)
+
+	reply(w, noreply, responseDeleted)
+}
+
+// incr handles incr and decr: <command> <key> <value> [noreply]
+func (s *Server) incr(ctx context.Context, w *bufio.Writer, command string, args []string) {
+	noreply, ok := parseNoreply(args, 2)
+	if !ok {
+		writeLine(w, responseError)
+		return
+	}
+
+	key := args[0]
+	if !s.validKey(key) {
+		reply(w, noreply, responseBadFormat)
+		return
+	}
+
+	delta, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		reply(w, noreply, responseBadDelta)
+		return
+	}
+
+	hits, misses := &s.stats.incrHits, &s.stats.incrMisses
+	incr := s.storageUseCase.Incr
+	if command == "decr" {
+		hits, misses = &s.stats.decrHits, &s.stats.decrMisses
+		incr = s.storageUseCase.Decr
+	}
+
+	mu := s.lockKey(key)
+	value, err := incr(ctx, key, delta)
+	mu.Unlock()
+
+	if errors.Is(err, storageUseCase.ErrNotFound) {
+		misses.Add(1)
+		reply(w, noreply, responseNotFound)
+		return
+	}
+	if errors.Is(err, storageUseCase.ErrNotNumeric) {
+		reply(w, noreply, responseNonNumeric)
+		return
+	}
+	if err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [Incr]", key, err)
+		return
+	}
+	hits.Add(1)
+
+	reply(w, noreply, strconv.FormatUint(value, 10))
+}
+
+// touch handles touch <key> <exptime> [noreply]
+func (s *Server) touch(ctx context.Context, w *bufio.Writer, args []string) {
+	noreply, ok := parseNoreply(args, 2)
+	if !ok {
+		writeLine(w, responseError)
+		return
+	}
+
+	key := args[0]
+	if !s.validKey(key) {
+		reply(w, noreply, responseBadFormat)
+		return
+	}
+
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		reply(w, noreply, "CLIENT_ERROR invalid exptime argument")
+		return
+	}
+
+	s.stats.cmdTouch.Add(1)
+
+	mu := s.lockKey(key)
+	defer mu.Unlock()
+
+	value, found, err := s.lookup(ctx, key)
+	if err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [Touch]", key, err)
+		return
+	}
+	if !found {
+		s.stats.touchMisses.Add(1)
+		reply(w, noreply, responseNotFound)
+		return
+	}
+
+	ttl, alive := ttlFromExptime(exptime)
+	if err := s.put(ctx, key, value, ttl, alive); err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [Touch]", key, err)
+		return
+	}
+	s.stats.touchHits.Add(1)
+
+	reply(w, noreply, responseTouched)
+}
+
+// flushAll handles flush_all [delay] [noreply]
+func (s *Server) flushAll(ctx context.Context, w *bufio.Writer, args []string) {
+	noreply := len(args) > 0 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	if len(args) > 1 {
+		writeLine(w, responseError)
+		return
+	}
+
+	var delay int64
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.ParseInt(args[0], 10, 64); err != nil || delay < 0 {
+			reply(w, noreply, responseBadFormat)
+			return
+		}
+	}
+
+	s.stats.cmdFlush.Add(1)
+
+	if delay > 0 {
+		time.AfterFunc(time.Duration(delay)*time.Second, func() {
+			if err := s.storageUseCase.Flush(ctx); err != nil {
+				s.log.Error().
+					Str(requestUUIDKey, fmt.Sprintf("%v", ctx.Value(requestUUIDKey))).
+					Str(method, "[MemcachedController] [FlushAll]").
+					Err(err).
+					Msg("unable to flush storage")
+			}
+		})
+		reply(w, noreply, responseOK)
+		return
+	}
+
+	if err := s.storageUseCase.Flush(ctx); err != nil {
+		s.serverError(ctx, w, "[MemcachedController] [FlushAll]", "", err)
+		return
+	}
+
+	reply(w, noreply, responseOK)
+}
+
+func (s *Server) writeStats(w *bufio.Writer, args []string) {
+	if len(args) > 0 {
+		writeLine(w, responseError)
+		return
+	}
+
+	s.mu.Lock()
+	currConns := len(s.conns)
+	s.mu.Unlock()
+
+	now := time.Now()
+
+	writeStat := func(name string, value any) {
+		fmt.Fprintf(w, "STAT %s %v%s", name, value, eol)
+	}
+
+	writeStat("pid", os.Getpid())
+	writeStat("uptime", int64(now.Sub(s.startTime).Seconds()))
+	writeStat("time", now.Unix())
+	writeStat("version", version)
+	writeStat("curr_connections", currConns)
+	writeStat("total_connections", s.stats.totalConns.Load())
+	writeStat("cmd_get", s.stats.cmdGet.Load())
+	writeStat("cmd_set", s.stats.cmdSet.Load())
+	writeStat("cmd_flush", s.stats.cmdFlush.Load())
+	writeStat("cmd_touch", s.stats.cmdTouch.Load())
+	writeStat("get_hits", s.stats.getHits.Load())
+	writeStat("get_misses", s.stats.getMisses.Load())
+	writeStat("delete_misses", s.stats.deleteMisses.Load())
+	writeStat("delete_hits", s.stats.deleteHits.Load())
+	writeStat("incr_misses", s.stats.incrMisses.Load())
+	writeStat("incr_hits", s.stats.incrHits.Load())
+	writeStat("decr_misses", s.stats.decrMisses.Load())
+	writeStat("decr_hits", s.stats.decrHits.Load())
+	writeStat("cas_misses", s.stats.casMisses.Load())
+	writeStat("cas_hits", s.stats.casHits.Load())
+	writeStat("cas_badval", s.stats.casBadVal.Load())
+	writeStat("touch_hits", s.stats.touchHits.Load())
+	writeStat("touch_misses", s.stats.touchMisses.Load())
+	writeStat("item_size_max", s.maxValueSize)
+	writeLine(w, responseEnd)
+}
+
+// lockKey locks writes to the key and returns the lock to unlock
+func (s *Server) lockKey(key string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	mu := &s.keyMu[h.Sum32()%keyLocks]
+	mu.Lock()
+
+	return mu
+}
+
+func (s *Server) lookup(ctx context.Context, key string) (string, bool, error) {
+	value, err := s.storageUseCase.Get(ctx, key)
+	if errors.Is(err, storageUseCase.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// put stores value or removes the key when exptime already passed
+func (s *Server) put(ctx context.Context, key, value string, ttl time.Duration, alive bool) error {
+	if alive {
+		return s.storageUseCase.Set(ctx, key, value, ttl)
+	}
+
+	return s.storageUseCase.Delete(ctx, key)
+}
+
+func (s *Server) serverError(ctx context.Context, w *bufio.Writer, methodName, key string, err error) {
+	s.log.Error().
+		Str(requestUUIDKey, fmt.Sprintf("%v", ctx.Value(requestUUIDKey))).
+		Str(method, methodName).
+		Str("key", key).
+		Err(err).
+		Msg("storage failure")
+
+	writeLine(w, responseStorageFailed)
+}
+
+func (s *Server) validKey(key string) bool {
+	if len(key) == 0 || len(key) > s.maxKeySize {
+		return false
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] <= ' ' || key[i] == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseNoreply checks that args contain argsCount arguments with optional noreply at the end
+func parseNoreply(args []string, argsCount int) (bool, bool) {
+	switch {
+	case len(args) == argsCount:
+		return false, true
+	case len(args) == argsCount+1 && args[argsCount] == "noreply":
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// ttlFromExptime converts memcached exptime to ttl,
+// the second value is false when the item is already expired
+func ttlFromExptime(exptime int64) (time.Duration, bool) {
+	switch {
+	case exptime < 0:
+		return 0, false
+	case exptime == 0:
+		return 0, true
+	case exptime > maxRelativeExptime:
+		seconds := exptime - time.Now().Unix()
+		if seconds <= 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	default:
+		return time.Duration(exptime) * time.Second, true
+	}
+}
+
+func casUnique(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+
+	return h.Sum64()
+}
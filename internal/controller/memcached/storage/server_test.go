@@ -0,0 +1,402 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	storageUseCase "github.com/swanden/storage/internal/usecase/storage"
+	"github.com/swanden/storage/pkg/logger"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeItem struct {
+	value string
+	// expiresAt is zero when the item never expires
+	expiresAt time.Time
+}
+
+// fakeStorage is the storage use case keeping items in a map
+type fakeStorage struct {
+	mu    sync.Mutex
+	items map[string]fakeItem
+	// getDelay widens the window between reading and writing a key
+	getDelay time.Duration
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{items: make(map[string]fakeItem)}
+}
+
+func (fs *fakeStorage) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	item := fakeItem{value: value}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+	fs.items[key] = item
+
+	return nil
+}
+
+func (fs *fakeStorage) Get(ctx context.Context, key string) (string, error) {
+	fs.mu.Lock()
+	item, ok := fs.lookup(key)
+	fs.mu.Unlock()
+
+	time.Sleep(fs.getDelay)
+
+	if !ok {
+		return "", errors.Wrap(storageUseCase.ErrNotFound, key)
+	}
+
+	return item.value, nil
+}
+
+func (fs *fakeStorage) Delete(ctx context.Context, key string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	delete(fs.items, key)
+
+	return nil
+}
+
+func (fs *fakeStorage) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return fs.add(key, func(n uint64) uint64 {
+		return n + delta
+	})
+}
+
+func (fs *fakeStorage) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return fs.add(key, func(n uint64) uint64 {
+		if delta > n {
+			return 0
+		}
+
+		return n - delta
+	})
+}
+
+func (fs *fakeStorage) add(key string, fn func(uint64) uint64) (uint64, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	item, ok := fs.lookup(key)
+	if !ok {
+		return 0, errors.Wrap(storageUseCase.ErrNotFound, key)
+	}
+
+	n, err := strconv.ParseUint(item.value, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(storageUseCase.ErrNotNumeric, key)
+	}
+
+	n = fn(n)
+	item.value = strconv.FormatUint(n, 10)
+	fs.items[key] = item
+
+	return n, nil
+}
+
+func (fs *fakeStorage) Flush(ctx context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.items = make(map[string]fakeItem)
+
+	return nil
+}
+
+func (fs *fakeStorage) lookup(key string) (fakeItem, bool) {
+	item, ok := fs.items[key]
+	if !ok || (!item.expiresAt.IsZero() && time.Now().After(item.expiresAt)) {
+		return fakeItem{}, false
+	}
+
+	return item, true
+}
+
+func (fs *fakeStorage) item(key string) fakeItem {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.items[key]
+}
+
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial connects one more client to the server of the client
+func (c *testClient) dial() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.Dial("tcp", c.conn.RemoteAddr().String())
+	if err != nil {
+		return nil, nil, err
+	}
+	c.t.Cleanup(func() { conn.Close() })
+
+	return conn, bufio.NewReader(conn), nil
+}
+
+// startServer serves a fake storage on loopback and connects to it
+func startServer(t *testing.T, opts ...Options) (*testClient, *fakeStorage) {
+	t.Helper()
+
+	lg, err := logger.New(context.Background(), logger.WithLevel("disabled"))
+	if err != nil {
+		t.Fatalf("unable to create logger: %v", err)
+	}
+
+	storage := newFakeStorage()
+
+	server, err := New(append([]Options{WithLogger(lg), WithStorageUseCase(storage)}, opts...)...)
+	if err != nil {
+		t.Fatalf("unable to create server: %v", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}, storage
+}
+
+// do sends the request and checks the reply lines
+func (c *testClient) do(request string, want ...string) {
+	c.t.Helper()
+
+	if _, err := c.conn.Write([]byte(request)); err != nil {
+		c.t.Fatalf("unable to write %q: %v", request, err)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	for _, w := range want {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			c.t.Fatalf("%q: unable to read reply: %v", request, err)
+		}
+		if line != w+eol {
+			c.t.Fatalf("%q: reply = %q, want %q", request, strings.TrimSuffix(line, eol), w)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	client, _ := startServer(t)
+
+	client.do("set a 0 0 1\r\n1\r\n", responseStored)
+	client.do("set b 5 0 2\r\n22\r\n", responseStored)
+
+	client.do("get a missing b\r\n", "VALUE a 0 1", "1", "VALUE b 0 2", "22", responseEnd)
+	client.do("gets a\r\n", fmt.Sprintf("VALUE a 0 1 %d", casUnique("1")), "1", responseEnd)
+	client.do("get\r\n", responseError)
+}
+
+func TestStore(t *testing.T) {
+	client, _ := startServer(t)
+
+	client.do("add key 0 0 4\r\nval1\r\n", responseStored)
+	client.do("add key 0 0 4\r\nval2\r\n", responseNotStored)
+	client.do("replace missing 0 0 4\r\nval1\r\n", responseNotStored)
+	client.do("replace key 0 0 4\r\nval3\r\n", responseStored)
+	client.do("get key missing\r\n", "VALUE key 0 4", "val3", responseEnd)
+
+	client.do(fmt.Sprintf("cas key 0 0 4 %d\r\nval4\r\n", casUnique("other")), responseExists)
+	client.do(fmt.Sprintf("cas key 0 0 4 %d\r\nval4\r\n", casUnique("val3")), responseStored)
+	client.do(fmt.Sprintf("cas missing 0 0 4 %d\r\nval4\r\n", casUnique("val4")), responseNotFound)
+	client.do("get key\r\n", "VALUE key 0 4", "val4", responseEnd)
+
+	client.do("set key 0 0 1\r\nvxx", responseBadChunk)
+	client.do("set key 0 0\r\n", responseError)
+	client.do("set key x 0 1\r\n", responseBadFormat)
+	client.do("set key 0 -1 1\r\nv\r\n", responseStored)
+	client.do("get key\r\n", responseEnd)
+
+	client.do("delete key\r\n", responseNotFound)
+	client.do("set key 0 0 1\r\nv\r\n", responseStored)
+	client.do("delete key\r\n", responseDeleted)
+}
+
+func TestNoreply(t *testing.T) {
+	client, _ := startServer(t)
+
+	client.do("set key 0 0 1 noreply\r\n1\r\n")
+	client.do("add key 0 0 1 noreply\r\n2\r\n")
+	client.do("incr key 5 noreply\r\n")
+	client.do("touch key 100 noreply\r\n")
+	client.do("get key\r\n", "VALUE key 0 1", "6", responseEnd)
+
+	client.do("delete key noreply\r\n")
+	client.do("flush_all noreply\r\n")
+	client.do("get key\r\n", responseEnd)
+}
+
+func TestLimits(t *testing.T) {
+	client, storage := startServer(t, WithMaxKeySize(10), WithMaxValueSize(5))
+
+	client.do("set key 0 0 6\r\n123456\r\n", responseTooLarge)
+	client.do("set key 0 0 5\r\n12345\r\n", responseStored)
+	client.do("get key\r\n", "VALUE key 0 5", "12345", responseEnd)
+
+	long := strings.Repeat("k", 11)
+	client.do("set "+long+" 0 0 1\r\n1\r\n", responseBadFormat)
+	client.do("get key "+long+"\r\n", responseBadFormat)
+	client.do("incr "+long+" 1\r\n", responseBadFormat)
+
+	if _, err := storage.Get(context.Background(), long); err == nil {
+		t.Errorf("key longer than the limit is stored")
+	}
+
+	client.do("get "+strings.Repeat("k", maxLineLength)+"\r\n", responseLineTooLong)
+}
+
+func TestIncr(t *testing.T) {
+	client, storage := startServer(t)
+
+	client.do("set counter 0 100 2\r\n10\r\n", responseStored)
+	expiresAt := storage.item("counter").expiresAt
+
+	client.do("incr counter 5\r\n", "15")
+	client.do("decr counter 20\r\n", "0")
+	client.do("incr counter 18446744073709551615\r\n", "18446744073709551615")
+	client.do("incr counter 2\r\n", "1")
+
+	if got := storage.item("counter").expiresAt; !got.Equal(expiresAt) {
+		t.Errorf("expiration after incr = %v, want %v", got, expiresAt)
+	}
+
+	client.do("incr missing 1\r\n", responseNotFound)
+	client.do("decr missing 1\r\n", responseNotFound)
+	client.do("set text 0 0 3\r\nabc\r\n", responseStored)
+	client.do("incr text 1\r\n", responseNonNumeric)
+	client.do("incr counter -1\r\n", responseBadDelta)
+	client.do("incr counter\r\n", responseError)
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	const (
+		clients = 4
+		incrs   = 100
+	)
+
+	client, storage := startServer(t)
+	storage.getDelay = time.Millisecond
+	client.do("set counter 0 100 1\r\n0\r\n", responseStored)
+
+	// requests sends the request until n replies are read or done is closed
+	requests := func(request string, n int, done chan struct{}) error {
+		conn, r, err := client.dial()
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i != n; i++ {
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+
+			if _, err := conn.Write([]byte(request)); err != nil {
+				return err
+			}
+			if _, err := r.ReadString('\n'); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// touch reads the key and writes it back, it must not write back a value from before incr
+	done := make(chan struct{})
+	touched := make(chan error, 1)
+	go func() {
+		touched <- requests("touch counter 100\r\n", -1, done)
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := requests("incr counter 1\r\n", incrs, nil); err != nil {
+				t.Errorf("incr: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	close(done)
+	if err := <-touched; err != nil {
+		t.Errorf("touch: %v", err)
+	}
+
+	if got, want := storage.item("counter").value, strconv.Itoa(clients*incrs); got != want {
+		t.Errorf("counter = %s, want %s", got, want)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	client, storage := startServer(t)
+
+	client.do("set key 0 0 3\r\nval\r\n", responseStored)
+	client.do("touch key 100\r\n", responseTouched)
+
+	if ttl := time.Until(storage.item("key").expiresAt); ttl <= 0 || ttl > 100*time.Second {
+		t.Errorf("ttl after touch = %v, want up to 100s", ttl)
+	}
+
+	client.do("touch missing 100\r\n", responseNotFound)
+	client.do("touch key -1\r\n", responseTouched)
+	client.do("get key\r\n", responseEnd)
+}
+
+func TestFlushAll(t *testing.T) {
+	client, _ := startServer(t)
+
+	client.do("set a 0 0 1\r\n1\r\n", responseStored)
+	client.do("set b 0 0 1\r\n2\r\n", responseStored)
+	client.do("flush_all\r\n", responseOK)
+	client.do("get a b\r\n", responseEnd)
+
+	client.do("set a 0 0 1\r\n1\r\n", responseStored)
+	client.do("flush_all 1\r\n", responseOK)
+	client.do("get a\r\n", "VALUE a 0 1", "1", responseEnd)
+	client.do("flush_all x\r\n", responseBadFormat)
+}
+
+func TestVersionAndQuit(t *testing.T) {
+	client, _ := startServer(t)
+
+	client.do("version\r\n", "VERSION "+version)
+	client.do("unknown\r\n", responseError)
+	client.do("quit\r\n")
+
+	client.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.r.ReadString('\n'); err == nil {
+		t.Errorf("connection is not closed after quit")
+	}
+}
@@ -24,6 +24,9 @@ type Storage interface {
 	Set(ctx context.Context, key, value string, ttl time.Duration) error
 	Get(ctx context.Context, key string) (string, error)
 	Delete(ctx context.Context, key string) error
+	Incr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Decr(ctx context.Context, key string, delta uint64) (uint64, error)
+	Flush(ctx context.Context) error
 }
 
 type UseCase struct {
@@ -156,3 +159,76 @@ func (uc UseCase) Delete(ctx context.Context, key string) error {
 
 	return nil
 }
+
+// Incr adds delta to the numeric value of the key keeping its ttl
+func (uc UseCase) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return uc.incr(ctx, "[StorageUseCase] [Incr]", key, delta, uc.storage.Incr)
+}
+
+// Decr subtracts delta from the numeric value of the key keeping its ttl
+func (uc UseCase) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return uc.incr(ctx, "[StorageUseCase] [Decr]", key, delta, uc.storage.Decr)
+}
+
+func (uc UseCase) incr(ctx context.Context, methodName, key string, delta uint64, incr func(context.Context, string, uint64) (uint64, error)) (uint64, error) {
+	requestUUID := fmt.Sprintf("%v", ctx.Value(requestUUIDKey))
+
+	uc.log.Debug().
+		Str(requestUUIDKey, requestUUID).
+		Str(method, methodName).
+		Str("key", key).
+		Uint64("delta", delta).
+		Msg("start incr")
+	defer uc.log.Debug().
+		Str(requestUUIDKey, requestUUID).
+		Str(method, methodName).
+		Str("key", key).
+		Uint64("delta", delta).
+		Msg("stop incr")
+
+	value, err := incr(ctx, key, delta)
+	if errors.Is(err, adapters.ErrNotFound) {
+		return 0, errors.Wrap(ErrNotFound, err.Error())
+	}
+	if errors.Is(err, adapters.ErrNotNumeric) {
+		return 0, errors.Wrap(ErrNotNumeric, err.Error())
+	}
+	if err != nil {
+		uc.log.Error().
+			Str(requestUUIDKey, requestUUID).
+			Str(method, methodName).
+			Str("key", key).
+			Err(err).
+			Msg(ErrIncr.Error())
+
+		return 0, errors.Wrap(ErrIncr, err.Error())
+	}
+
+	return value, nil
+}
+
+func (uc UseCase) Flush(ctx context.Context) error {
+	requestUUID := fmt.Sprintf("%v", ctx.Value(requestUUIDKey))
+
+	uc.log.Debug().
+		Str(requestUUIDKey, requestUUID).
+		Str(method, "[StorageUseCase] [Flush]").
+		Msg("start flush")
+	defer uc.log.Debug().
+		Str(requestUUIDKey, requestUUID).
+		Str(method, "[StorageUseCase] [Flush]").
+		Msg("stop flush")
+
+	err := uc.storage.Flush(ctx)
+	if err != nil {
+		uc.log.Error().
+			Str(requestUUIDKey, requestUUID).
+			Str(method, "[StorageUseCase] [Flush]").
+			Err(err).
+			Msg(ErrFlush.Error())
+
+		return errors.Wrap(ErrFlush, err.Error())
+	}
+
+	return nil
+}
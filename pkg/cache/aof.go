@@ -0,0 +1,560 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Append-only log layout, integers are big endian:
+//
+//	magic "SCAF" | version uint16 | records
+//
+// every record is payload length uint32 | CRC-32C of payload uint32 | payload,
+// payload is operation byte | key length uvarint | key | value length uvarint | value |
+// expiration time in unix nanoseconds varint, 0 - no expire time.
+// Records keep the state of a key instead of the change, so replaying a record twice is harmless
+const (
+	aofMagic   = "SCAF"
+	aofVersion = 1
+
+	aofOpSet    = 1
+	aofOpDelete = 2
+	aofOpFlush  = 3
+
+	aofRecordHeaderSize = 8
+	aofMaxRecordSize    = 1 << 31
+
+	defaultAOFRewriteMinSize = 64 << 20
+	aofLoopInterval          = time.Second
+)
+
+type FsyncPolicy int
+
+const (
+	// FsyncEverySecond syncs the log once a second, a crash loses up to a second of writes
+	FsyncEverySecond FsyncPolicy = iota
+	// FsyncAlways syncs the log on every write
+	FsyncAlways
+	// FsyncNever leaves syncing to the OS
+	FsyncNever
+)
+
+// ParseFsyncPolicy returns fsync policy by its name: always, everysec or never
+func ParseFsyncPolicy(name string) (FsyncPolicy, error) {
+	switch name {
+	case "always":
+		return FsyncAlways, nil
+	case "everysec":
+		return FsyncEverySecond, nil
+	case "never":
+		return FsyncNever, nil
+	default:
+		return 0, errors.Wrap(ErrUnknownFsyncPolicy, name)
+	}
+}
+
+// aof is append-only log of cache changes, records are appended under the shard lock,
+// so the log order of one key is the order its changes were applied in
+type aof struct {
+	mu   sync.Mutex
+	file *os.File
+	path string
+
+	fsync FsyncPolicy
+	dirty bool
+
+	size int64
+	// baseSize is the log size after the last rewrite
+	baseSize       int64
+	rewriteMinSize int64
+
+	// rewriteBuf collects records appended while the log is rewritten
+	rewriteBuf *bytes.Buffer
+
+	errorHandler func(error)
+}
+
+// OpenAOF replays the append-only log and starts appending Set, Delete and Flush to it.
+// A torn or damaged record at the end of the log left by a crash is cut off,
+// a damaged record in the middle fails with ErrAOFFormat and the log is not changed
+func (c *Cache) OpenAOF() error {
+	if c.aofFile == "" {
+		return ErrAOFDisabled
+	}
+
+	f, err := os.OpenFile(c.aofFile, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return errors.Wrap(ErrAOFOpen, err.Error())
+	}
+
+	size, err := c.replayAOF(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	if size == 0 {
+		if _, err := f.Write(aofHeader()); err != nil {
+			f.Close()
+			return errors.Wrap(ErrAOFOpen, err.Error())
+		}
+		size = int64(len(aofHeader()))
+	}
+
+	a := &aof{
+		file:           f,
+		path:           c.aofFile,
+		fsync:          c.aofFsync,
+		size:           size,
+		baseSize:       size,
+		rewriteMinSize: c.aofRewriteMinSize,
+		errorHandler:   c.aofErrorHandler,
+	}
+
+	c.setLog(a)
+	c.aof = a
+
+	go c.aofLoop()
+
+	return nil
+}
+
+// replayAOF applies log records and returns the log size. A record cut off by the end
+// of the log is left by an interrupted append, so the log is truncated after the last
+// good record. A bad record followed by other ones means the log is corrupted,
+// it fails with ErrAOFFormat and the log is left as is
+func (c *Cache) replayAOF(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, errors.Wrap(ErrAOFOpen, err.Error())
+	}
+	fileSize := info.Size()
+
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(aofHeader()))
+	n, err := io.ReadFull(r, header)
+	if n == 0 && err == io.EOF {
+		return 0, nil
+	}
+	if err != nil || !bytes.Equal(header[:len(aofMagic)], []byte(aofMagic)) {
+		return 0, ErrAOFFormat
+	}
+	if binary.BigEndian.Uint16(header[len(aofMagic):]) != aofVersion {
+		return 0, ErrAOFFormat
+	}
+
+	offset := int64(len(header))
+	recordHeader := make([]byte, aofRecordHeaderSize)
+
+	for offset < fileSize {
+		if _, err := io.ReadFull(r, recordHeader); err != nil {
+			break
+		}
+
+		size := binary.BigEndian.Uint32(recordHeader)
+		if size == 0 || size >= aofMaxRecordSize {
+			// a torn append may leave zeros instead of the record
+			if zeros, err := onlyZeros(r); err != nil || !zeros || size != 0 {
+				return 0, errors.Wrap(ErrAOFFormat, fmt.Sprintf("bad record size at offset %d", offset))
+			}
+			break
+		}
+
+		end := offset + int64(aofRecordHeaderSize) + int64(size)
+		if end > fileSize {
+			break
+		}
+
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return 0, errors.Wrap(ErrAOFOpen, err.Error())
+		}
+
+		bad := crc32.Checksum(payload, snapshotTable) != binary.BigEndian.Uint32(recordHeader[4:])
+		if !bad {
+			bad = c.applyAOFRecord(payload) != nil
+		}
+		if bad {
+			if end < fileSize {
+				return 0, errors.Wrap(ErrAOFFormat, fmt.Sprintf("bad record at offset %d", offset))
+			}
+			break
+		}
+
+		offset = end
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return 0, errors.Wrap(ErrAOFOpen, err.Error())
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, errors.Wrap(ErrAOFOpen, err.Error())
+	}
+
+	return offset, nil
+}
+
+// onlyZeros reports whether the rest of the reader is zero bytes
+func onlyZeros(r *bufio.Reader) (bool, error) {
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if b != 0 {
+			return false, nil
+		}
+	}
+}
+
+func (c *Cache) applyAOFRecord(payload []byte) error {
+	r := bytes.NewReader(payload)
+
+	op, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+
+	if op == aofOpFlush {
+		for _, s := range c.shards {
+			s.flush()
+		}
+		return nil
+	}
+
+	key, err := readAOFString(r)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case aofOpDelete:
+		c.shard(key).delete(key)
+	case aofOpSet:
+		value, err := readAOFString(r)
+		if err != nil {
+			return err
+		}
+
+		expiresAt, err := binary.ReadVarint(r)
+		if err != nil {
+			return err
+		}
+
+		var ttl time.Duration
+		if expiresAt != 0 {
+			ttl = time.Until(time.Unix(0, expiresAt))
+			if ttl <= 0 {
+				c.shard(key).delete(key)
+				return nil
+			}
+		}
+
+		c.fit(key, c.shard(key).set(key, value, ttl))
+	default:
+		return ErrAOFFormat
+	}
+
+	return nil
+}
+
+func readAOFString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if n > uint64(r.Len()) {
+		return "", ErrAOFFormat
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// RewriteAOF compacts the log into a fresh base with the current items plus a tail
+// of records appended while the base was written, writers are not blocked while
+// the base is written
+func (c *Cache) RewriteAOF() error {
+	if c.aof == nil {
+		return ErrAOFDisabled
+	}
+
+	c.aofRewriteMu.Lock()
+	defer c.aofRewriteMu.Unlock()
+
+	a := c.aof
+
+	a.mu.Lock()
+	a.rewriteBuf = new(bytes.Buffer)
+	a.mu.Unlock()
+
+	tmp, err := c.writeAOFBase()
+	if err != nil {
+		a.mu.Lock()
+		a.rewriteBuf = nil
+		a.mu.Unlock()
+
+		return errors.Wrap(ErrAOFRewrite, err.Error())
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err = a.switchTo(tmp)
+	a.rewriteBuf = nil
+
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return errors.Wrap(ErrAOFRewrite, err.Error())
+	}
+
+	return nil
+}
+
+// writeAOFBase writes set records of all items to a temp file next to the log
+func (c *Cache) writeAOFBase() (*os.File, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(c.aofFile), filepath.Base(c.aofFile)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(tmp)
+	if _, err := w.Write(aofHeader()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return nil, err
+	}
+
+	for _, s := range c.shards {
+		for _, e := range s.snapshot(nanotime()) {
+			if _, err := w.Write(encodeAOFSet(e.key, e.value, e.ttl)); err != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+
+				return nil, err
+			}
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+// switchTo appends the rewrite tail to the new base and replaces the log with it, a.mu must be held
+func (a *aof) switchTo(tmp *os.File) error {
+	if a.file == nil {
+		return os.ErrClosed
+	}
+
+	if _, err := tmp.Write(a.rewriteBuf.Bytes()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		return err
+	}
+
+	if d, err := os.Open(filepath.Dir(a.path)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	a.file.Close()
+	a.file = tmp
+	a.size = info.Size()
+	a.baseSize = a.size
+	a.dirty = false
+
+	return nil
+}
+
+func (a *aof) set(key, value string, ttl time.Duration) {
+	a.append(encodeAOFSet(key, value, ttl))
+}
+
+func (a *aof) delete(key string) {
+	a.append(encodeAOFDelete(key))
+}
+
+func (a *aof) flush() {
+	a.append(encodeAOFFlush())
+}
+
+// append writes record to the log, mu of the changed shard must be held
+func (a *aof) append(record []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return
+	}
+
+	if a.rewriteBuf != nil {
+		a.rewriteBuf.Write(record)
+	}
+
+	if _, err := a.file.Write(record); err != nil {
+		a.fail(errors.Wrap(ErrAOFWrite, err.Error()))
+		return
+	}
+	a.size += int64(len(record))
+
+	if a.fsync == FsyncAlways {
+		if err := a.file.Sync(); err != nil {
+			a.fail(errors.Wrap(ErrAOFWrite, err.Error()))
+		}
+		return
+	}
+
+	a.dirty = true
+}
+
+func (a *aof) fail(err error) {
+	if a.errorHandler != nil {
+		go a.errorHandler(err)
+	}
+}
+
+func (a *aof) sync() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.dirty || a.file == nil {
+		return
+	}
+
+	if err := a.file.Sync(); err != nil {
+		a.fail(errors.Wrap(ErrAOFWrite, err.Error()))
+		return
+	}
+	a.dirty = false
+}
+
+func (a *aof) needsRewrite() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.rewriteMinSize > 0 && a.size >= a.rewriteMinSize && a.size >= 2*a.baseSize
+}
+
+func (a *aof) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+
+	err := a.file.Sync()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	a.file = nil
+
+	return err
+}
+
+// aofLoop syncs the log every second and rewrites it when it has doubled since the last rewrite
+func (c *Cache) aofLoop() {
+	ticker := time.NewTicker(aofLoopInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if c.aof.fsync == FsyncEverySecond {
+				c.aof.sync()
+			}
+
+			if c.aof.needsRewrite() {
+				if err := c.RewriteAOF(); err != nil {
+					c.aof.fail(err)
+				}
+			}
+		}
+	}
+}
+
+func aofHeader() []byte {
+	header := make([]byte, len(aofMagic)+2)
+	copy(header, aofMagic)
+	binary.BigEndian.PutUint16(header[len(aofMagic):], aofVersion)
+
+	return header
+}
+
+func encodeAOFRecord(payload []byte) []byte {
+	record := make([]byte, aofRecordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, snapshotTable))
+	copy(record[aofRecordHeaderSize:], payload)
+
+	return record
+}
+
+// encodeAOFSet converts ttl to the wall clock expiration time, so it survives restarts
+func encodeAOFSet(key, value string, ttl time.Duration) []byte {
+	payload := make([]byte, 0, 1+3*binary.MaxVarintLen64+len(key)+len(value))
+	payload = append(payload, aofOpSet)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	payload = binary.AppendUvarint(payload, uint64(len(value)))
+	payload = append(payload, value...)
+
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	payload = binary.AppendVarint(payload, expiresAt)
+
+	return encodeAOFRecord(payload)
+}
+
+func encodeAOFDelete(key string) []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(key))
+	payload = append(payload, aofOpDelete)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+
+	return encodeAOFRecord(payload)
+}
+
+func encodeAOFFlush() []byte {
+	return encodeAOFRecord([]byte{aofOpFlush})
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestAOF(t *testing.T, path string, opts ...Option) *Cache {
+	t.Helper()
+
+	cache := New(append([]Option{WithAOFFile(path), WithAOFFsync(FsyncAlways)}, opts...)...)
+	if err := cache.OpenAOF(); err != nil {
+		t.Fatalf("cache.OpenAOF() = %v, want %v", err, nil)
+	}
+
+	return cache
+}
+
+func TestAOFReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	cache := openTestAOF(t, path)
+	cache.Set("flushed", "val", 0)
+	cache.Flush()
+	cache.Set("key1", "val1", 0)
+	cache.Set("key2", "val2", time.Hour)
+	cache.Set("key3", "val3", 0)
+	cache.Set("key1", "new1", 0)
+	cache.Delete("key3")
+	cache.Set("expired", "val", time.Millisecond)
+	cache.Close()
+
+	time.Sleep(5 * time.Millisecond)
+
+	restored := openTestAOF(t, path)
+	defer restored.Close()
+
+	want := map[string]string{"key1": "new1", "key2": "val2"}
+	for key, value := range want {
+		if gotVal, gotOk := restored.Get(key); gotVal != value || gotOk != true {
+			t.Errorf("restored.Get(%q) = %q, %t, want %q, %t", key, gotVal, gotOk, value, true)
+		}
+	}
+	for _, key := range []string{"flushed", "key3", "expired"} {
+		if _, gotOk := restored.Get(key); gotOk != false {
+			t.Errorf("restored.Get(%q) = %t, want %t", key, gotOk, false)
+		}
+	}
+}
+
+func TestAOFTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	cache := openTestAOF(t, path)
+	cache.Set("key1", "val1", 0)
+	cache.Set("key2", "val2", 0)
+	cache.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("os.Stat() = %v, want %v", err, nil)
+	}
+	if err := os.Truncate(path, info.Size()-2); err != nil {
+		t.Fatalf("os.Truncate() = %v, want %v", err, nil)
+	}
+
+	restored := openTestAOF(t, path)
+
+	if gotVal, gotOk := restored.Get("key1"); gotVal != "val1" || gotOk != true {
+		t.Errorf("restored.Get(%q) = %q, %t, want %q, %t", "key1", gotVal, gotOk, "val1", true)
+	}
+	if _, gotOk := restored.Get("key2"); gotOk != false {
+		t.Errorf("restored.Get(%q) = %t, want %t", "key2", gotOk, false)
+	}
+
+	// records appended after the cut off one must be replayed
+	restored.Set("key3", "val3", 0)
+	restored.Close()
+
+	again := openTestAOF(t, path)
+	defer again.Close()
+
+	if gotVal, gotOk := again.Get("key3"); gotVal != "val3" || gotOk != true {
+		t.Errorf("again.Get(%q) = %q, %t, want %q, %t", "key3", gotVal, gotOk, "val3", true)
+	}
+}
+
+func TestAOFCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	cache := openTestAOF(t, path)
+	cache.Set("key1", "val1", 0)
+	cache.Set("key2", "val2", 0)
+	cache.Set("key3", "val3", 0)
+	cache.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile() = %v, want %v", err, nil)
+	}
+
+	// a bad last record is left by an interrupted append and is cut off
+	last := append([]byte(nil), data...)
+	last[len(last)-1] ^= 0xff
+	if err := os.WriteFile(path, last, 0o644); err != nil {
+		t.Fatalf("os.WriteFile() = %v, want %v", err, nil)
+	}
+
+	restored := openTestAOF(t, path)
+	if _, gotOk := restored.Get("key3"); gotOk != false {
+		t.Errorf("restored.Get(%q) = %t, want %t", "key3", gotOk, false)
+	}
+	if gotVal, gotOk := restored.Get("key2"); gotVal != "val2" || gotOk != true {
+		t.Errorf("restored.Get(%q) = %q, %t, want %q, %t", "key2", gotVal, gotOk, "val2", true)
+	}
+	restored.Close()
+
+	// a bad record followed by good ones is corruption, the log must not be cut off
+	middle := append([]byte(nil), data...)
+	middle[len(aofHeader())+aofRecordHeaderSize+1] ^= 0xff
+	if err := os.WriteFile(path, middle, 0o644); err != nil {
+		t.Fatalf("os.WriteFile() = %v, want %v", err, nil)
+	}
+
+	corrupted := New(WithAOFFile(path))
+	defer corrupted.Close()
+
+	if err := corrupted.OpenAOF(); !errors.Is(err, ErrAOFFormat) {
+		t.Errorf("corrupted.OpenAOF() = %v, want %v", err, ErrAOFFormat)
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(len(middle)) {
+		t.Errorf("log size = %d, want %d", info.Size(), len(middle))
+	}
+}
+
+func TestAOFRewrite(t *testing.T) {
+	const writes = 1000
+
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	cache := openTestAOF(t, path, WithAOFFsync(FsyncNever))
+	for i := 0; i < writes; i++ {
+		cache.Set("key", fmt.Sprintf("val%d", i), 0)
+	}
+	cache.Set("other", "val", 0)
+
+	before, _ := os.Stat(path)
+
+	if err := cache.RewriteAOF(); err != nil {
+		t.Fatalf("cache.RewriteAOF() = %v, want %v", err, nil)
+	}
+
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("log size after rewrite = %d, want less than %d", after.Size(), before.Size())
+	}
+
+	cache.Set("tail", "val", 0)
+	cache.Close()
+
+	restored := openTestAOF(t, path)
+	defer restored.Close()
+
+	want := map[string]string{"key": fmt.Sprintf("val%d", writes-1), "other": "val", "tail": "val"}
+	for key, value := range want {
+		if gotVal, gotOk := restored.Get(key); gotVal != value || gotOk != true {
+			t.Errorf("restored.Get(%q) = %q, %t, want %q, %t", key, gotVal, gotOk, value, true)
+		}
+	}
+
+	if files, _ := filepath.Glob(path + ".tmp-*"); len(files) != 0 {
+		t.Errorf("temp files left: %v", files)
+	}
+}
+
+func TestAOFOversized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	cache := openTestAOF(t, path, WithMaxBytes(1000))
+	cache.Set("key", "val", 0)
+	cache.Set("key", strings.Repeat("v", 1000), 0)
+	cache.Close()
+
+	restored := openTestAOF(t, path, WithMaxBytes(1000))
+	defer restored.Close()
+
+	if _, gotOk := restored.Get("key"); gotOk != false {
+		t.Errorf("restored.Get(%q) = %t, want %t", "key", gotOk, false)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// SetIfAbsent sets key-value pair with ttl when there is no such item or it's expired,
+// it reports whether the value is set
+func (c *TypedCache[K, V]) SetIfAbsent(key K, value V, ttl time.Duration) bool {
+	var set bool
+
+	c.notify(c.fit(key, c.shard(key).update(key, func(_ V, _ time.Duration, ok bool) (V, time.Duration, updateOp) {
+		if ok {
+			return value, 0, updateNone
+		}
+
+		set = true
+		return value, ttl, updateSet
+	})))
+
+	return set
+}
+
+// GetAndDelete deletes the item and returns its value, false when there is no such item or it's expired
+func (c *TypedCache[K, V]) GetAndDelete(key K) (V, bool) {
+	var value V
+	var found bool
+
+	c.notify(c.fit(key, c.shard(key).update(key, func(v V, ttl time.Duration, ok bool) (V, time.Duration, updateOp) {
+		value, found = v, ok
+		return v, ttl, updateDelete
+	})))
+
+	return value, found
+}
+
+// Update replaces the value of the key with the one fn returns, fn gets the current value and false
+// when there is no such item or it's expired. The item is deleted when fn returns false.
+// The item keeps its ttl, a new item has no expire time. fn runs under the shard lock,
+// so it must not use the cache. Update returns the new value and whether it's stored
+func (c *TypedCache[K, V]) Update(key K, fn func(value V, ok bool) (V, bool)) (V, bool) {
+	var value V
+	var keep bool
+
+	c.notify(c.fit(key, c.shard(key).update(key, func(v V, ttl time.Duration, ok bool) (V, time.Duration, updateOp) {
+		value, keep = fn(v, ok)
+		if !keep {
+			var zero V
+			value = zero
+			return value, 0, updateDelete
+		}
+
+		return value, ttl, updateSet
+	})))
+
+	return value, keep
+}
+
+// CompareAndSwap sets the value of the key to new when it's old, the item keeps its ttl.
+// It reports whether the value is swapped, an expired item never is
+func (c *Cache) CompareAndSwap(key, old, new string) bool {
+	var swapped bool
+
+	c.notify(c.fit(key, c.shard(key).update(key, func(value string, ttl time.Duration, ok bool) (string, time.Duration, updateOp) {
+		if !ok || value != old {
+			return value, ttl, updateNone
+		}
+
+		swapped = true
+		return new, ttl, updateSet
+	})))
+
+	return swapped
+}
+
+// IncrementBy adds delta to the integer value of the key and returns the result, the item keeps
+// its ttl. A missing or expired item is counted from 0 and has no expire time
+func (c *Cache) IncrementBy(key string, delta int64) (int64, error) {
+	var n int64
+	var err error
+
+	c.notify(c.fit(key, c.shard(key).update(key, func(value string, ttl time.Duration, ok bool) (string, time.Duration, updateOp) {
+		n = 0
+		if ok {
+			if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+				err = ErrNotInteger
+				return value, ttl, updateNone
+			}
+		}
+
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			err = ErrOverflow
+			return value, ttl, updateNone
+		}
+
+		n += delta
+		return strconv.FormatInt(n, 10), ttl, updateSet
+	})))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
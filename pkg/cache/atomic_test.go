@@ -0,0 +1,166 @@
+package cache
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetIfAbsent(t *testing.T) {
+	cache := New()
+	defer cache.Close()
+
+	if !cache.SetIfAbsent("key", "val1", 0) {
+		t.Errorf("SetIfAbsent() of a new key = false")
+	}
+	if cache.SetIfAbsent("key", "val2", 0) {
+		t.Errorf("SetIfAbsent() of an existing key = true")
+	}
+	if value, _ := cache.Get("key"); value != "val1" {
+		t.Errorf("value = %q, want %q", value, "val1")
+	}
+
+	cache.Set("expired", "val", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if !cache.SetIfAbsent("expired", "new", time.Hour) {
+		t.Errorf("SetIfAbsent() of an expired key = false")
+	}
+	if ttl, ok := cache.TTL("expired"); !ok || ttl <= 0 {
+		t.Errorf("TTL() = %v, %v, want positive ttl", ttl, ok)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	cache := New()
+	defer cache.Close()
+
+	if cache.CompareAndSwap("key", "", "val") {
+		t.Errorf("CompareAndSwap() of a missing key = true")
+	}
+
+	cache.Set("key", "val1", time.Hour)
+	if cache.CompareAndSwap("key", "other", "val2") {
+		t.Errorf("CompareAndSwap() with wrong old value = true")
+	}
+	if !cache.CompareAndSwap("key", "val1", "val2") {
+		t.Errorf("CompareAndSwap() = false")
+	}
+	if value, _ := cache.Get("key"); value != "val2" {
+		t.Errorf("value = %q, want %q", value, "val2")
+	}
+	if ttl, _ := cache.TTL("key"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("ttl = %v, want it kept", ttl)
+	}
+
+	cache.Set("expired", "val", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if cache.CompareAndSwap("expired", "val", "new") {
+		t.Errorf("CompareAndSwap() of an expired key = true")
+	}
+}
+
+func TestIncrementBy(t *testing.T) {
+	cache := New()
+	defer cache.Close()
+
+	if n, err := cache.IncrementBy("counter", 5); err != nil || n != 5 {
+		t.Errorf("IncrementBy() = %d, %v, want 5", n, err)
+	}
+	if n, err := cache.IncrementBy("counter", -7); err != nil || n != -2 {
+		t.Errorf("IncrementBy() = %d, %v, want -2", n, err)
+	}
+
+	cache.Set("text", "abc", 0)
+	if _, err := cache.IncrementBy("text", 1); err != ErrNotInteger {
+		t.Errorf("IncrementBy() of text error = %v, want %v", err, ErrNotInteger)
+	}
+
+	cache.Set("max", strconv.FormatInt(math.MaxInt64, 10), 0)
+	if _, err := cache.IncrementBy("max", 1); err != ErrOverflow {
+		t.Errorf("IncrementBy() error = %v, want %v", err, ErrOverflow)
+	}
+
+	cache.Set("expired", "10", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if n, err := cache.IncrementBy("expired", 1); err != nil || n != 1 {
+		t.Errorf("IncrementBy() of an expired key = %d, %v, want 1", n, err)
+	}
+	if ttl, ok := cache.TTL("expired"); !ok || ttl != 0 {
+		t.Errorf("TTL() = %v, %v, want no expire time", ttl, ok)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.IncrementBy("concurrent", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, _ := cache.Get("concurrent"); value != "1000" {
+		t.Errorf("value = %q, want %q", value, "1000")
+	}
+}
+
+func TestGetAndDelete(t *testing.T) {
+	cache := New()
+	defer cache.Close()
+
+	cache.Set("key", "val", 0)
+	if value, ok := cache.GetAndDelete("key"); !ok || value != "val" {
+		t.Errorf("GetAndDelete() = %q, %v, want %q", value, ok, "val")
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("key is not deleted")
+	}
+	if _, ok := cache.GetAndDelete("key"); ok {
+		t.Errorf("GetAndDelete() of a missing key = true")
+	}
+
+	cache.Set("expired", "val", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := cache.GetAndDelete("expired"); ok {
+		t.Errorf("GetAndDelete() of an expired key = true")
+	}
+	if stats := cache.Stats(); stats.Deletes != 1 || stats.Entries != 0 {
+		t.Errorf("stats = %+v, want 1 delete and no entries", stats)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	cache := NewTyped[string, []int]()
+	defer cache.Close()
+
+	appendValue := func(v int) func([]int, bool) ([]int, bool) {
+		return func(values []int, ok bool) ([]int, bool) {
+			return append(values, v), true
+		}
+	}
+
+	cache.Update("key", appendValue(1))
+	if values, ok := cache.Update("key", appendValue(2)); !ok || len(values) != 2 || values[1] != 2 {
+		t.Errorf("Update() = %v, %v, want [1 2]", values, ok)
+	}
+
+	if _, ok := cache.Update("key", func([]int, bool) ([]int, bool) { return nil, false }); ok {
+		t.Errorf("Update() deleting the key = true")
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Errorf("key is not deleted")
+	}
+
+	cache.Set("expired", []int{1}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	cache.Update("expired", func(values []int, ok bool) ([]int, bool) {
+		if ok || values != nil {
+			t.Errorf("fn got %v, %v for an expired key", values, ok)
+		}
+		return values, true
+	})
+}
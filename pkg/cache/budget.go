@@ -0,0 +1,115 @@
+package cache
+
+import "sync/atomic"
+
+// budget is the limits of the whole cache shared by its shards. Every shard has its fair share
+// of the limits, it may take more while the cache is under its limits, so an item which fits
+// the cache is stored whatever shard it falls into
+type budget struct {
+	maxEntries int64
+	maxBytes   int64
+
+	entries atomic.Int64
+	bytes   atomic.Int64
+}
+
+// newBudget returns nil when the cache is not bounded
+func newBudget(maxEntries int, maxBytes int64) *budget {
+	if maxEntries <= 0 && maxBytes <= 0 {
+		return nil
+	}
+
+	return &budget{maxEntries: int64(maxEntries), maxBytes: maxBytes}
+}
+
+func (b *budget) add(entries int, bytes int64) {
+	b.entries.Add(int64(entries))
+	b.bytes.Add(bytes)
+}
+
+func (b *budget) overEntries() bool {
+	return b.maxEntries > 0 && b.entries.Load() > b.maxEntries
+}
+
+func (b *budget) overBytes() bool {
+	return b.maxBytes > 0 && b.bytes.Load() > b.maxBytes
+}
+
+func (b *budget) over() bool {
+	return b.overEntries() || b.overBytes()
+}
+
+// fit evicts items while the cache is over its limits after the key is changed and appends them
+// to evicted. The shard of the key has evicted its own items down to its share already,
+// so the rest is taken from the shards which are the most over their shares. The key is evicted
+// only when the policy of its shard chooses it and no other shard has anything to evict
+func (c *TypedCache[K, V]) fit(key K, evicted []evictedEntry[K, V]) []evictedEntry[K, V] {
+	if c.budget == nil {
+		return evicted
+	}
+
+	// skipped are shards whose victim is the key
+	var skipped []bool
+
+	for c.budget.over() {
+		best, bestExcess := -1, int64(0)
+		for i, s := range c.shards {
+			if skipped != nil && skipped[i] {
+				continue
+			}
+			if excess := s.excess(); best == -1 || excess > bestExcess {
+				best, bestExcess = i, excess
+			}
+		}
+
+		if best == -1 {
+			evicted, _ = c.shard(key).evictOne(evicted, key, true)
+			return evicted
+		}
+
+		var ok bool
+		if evicted, ok = c.shards[best].evictOne(evicted, key, false); !ok {
+			if skipped == nil {
+				skipped = make([]bool, len(c.shards))
+			}
+			skipped[best] = true
+		}
+	}
+
+	return evicted
+}
+
+// overShare reports whether the shard is over its share of the cache limits, s.mu must be held
+func (s *shard[K, V]) overShare() bool {
+	return (s.maxEntries > 0 && len(s.data) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes)
+}
+
+// excess is how much the shard is over its share of the limit the cache is over
+func (s *shard[K, V]) excess() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.budget.overEntries() {
+		return int64(len(s.data) - s.maxEntries)
+	}
+
+	return s.bytes - s.maxBytes
+}
+
+// evictOne evicts the item chosen by eviction policy if the cache is still over its limits,
+// it reports false when there is nothing to evict or the victim is the kept key and force is false
+func (s *shard[K, V]) evictOne(evicted []evictedEntry[K, V], keep K, force bool) ([]evictedEntry[K, V], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.budget.over() {
+		return evicted, true
+	}
+
+	key, ok := s.policy.Victim()
+	if !ok || (key == keep && !force) {
+		return evicted, false
+	}
+
+	return s.evictKeyLocked(evicted, key, nanotime()), true
+}
@@ -1,51 +1,88 @@
 package cache
 
 import (
+	"github.com/pkg/errors"
+	"hash/maphash"
 	"sync"
 	"time"
 )
 
-type Item struct {
-	putTime time.Time
-	ttl     time.Duration
-	value   string
-}
-
+// Cache is in-memory key-value storage of strings, it is TypedCache which
+// can be persisted with snapshots and append-only log
 type Cache struct {
-	mu   sync.RWMutex
-	data map[string]Item
-}
+	*TypedCache[string, string]
 
-func New() *Cache {
-	c := &Cache{}
-	c.data = make(map[string]Item)
+	snapshotFile         string
+	snapshotInterval     time.Duration
+	snapshotErrorHandler func(error)
+	snapshotMu           sync.Mutex
 
-	return c
+	aofFile           string
+	aofFsync          FsyncPolicy
+	aofRewriteMinSize int64
+	aofErrorHandler   func(error)
+	aofRewriteMu      sync.Mutex
+	// aof is nil until OpenAOF
+	aof *aof
+
+	hub *hub
+	// indexes are ordered keys of the shards, nil unless WithOrderedIndex is set
+	indexes []*skipList
 }
 
-func (c *Cache) Get(key string) (string, bool) {
-	c.mu.RLock()
-	item, ok := c.data[key]
-	defer c.mu.RUnlock()
+func New(opts ...Option) *Cache {
+	o := getDefaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-	now := time.Now()
-	if item.ttl > 0 && now.Sub(item.putTime) > item.ttl {
-		return "", false
+	// strings are measured and hashed directly without the generic fallbacks
+	seed := maphash.MakeSeed()
+	typed := typedOptions[string, string]{
+		options: o,
+		sizeFunc: func(key, value string) int64 {
+			return int64(len(key) + len(value))
+		},
+		keyHash: func(key string) uint64 {
+			return maphash.String(seed, key)
+		},
+	}
+	if o.policy != nil {
+		typed.newPolicy = o.policy
 	}
 
-	return item.value, ok
-}
+	c := &Cache{
+		TypedCache:           newTypedCache[string, string](typed),
+		snapshotFile:         o.snapshotFile,
+		snapshotInterval:     o.snapshotInterval,
+		snapshotErrorHandler: o.snapshotErrorHandler,
+		aofFile:              o.aofFile,
+		aofFsync:             o.aofFsync,
+		aofRewriteMinSize:    o.aofRewriteMinSize,
+		aofErrorHandler:      o.aofErrorHandler,
+		hub:                  newHub(o.subscriptionBuffer, o.slowSubscriberPolicy),
+	}
+	c.setObserver(c.hub)
+	if o.orderedIndex {
+		c.setIndexes()
+	}
+
+	if c.snapshotFile != "" && c.snapshotInterval > 0 {
+		go c.snapshotter()
+	}
 
-// Set sets key-value pair
-// ttl - expiration time, if 0 - no expire time
-func (c *Cache) Set(key string, value string, ttl time.Duration) {
-	c.mu.Lock()
-	c.data[key] = Item{putTime: time.Now(), value: value, ttl: ttl}
-	c.mu.Unlock()
+	return c
 }
 
-func (c *Cache) Delete(key string) {
-	c.mu.Lock()
-	delete(c.data, key)
-	c.mu.Unlock()
+// Close stops the background janitor and snapshots, syncs and closes append-only log
+// and closes subscriptions, it is safe to call Close several times
+func (c *Cache) Close() {
+	c.TypedCache.Close()
+	c.hub.close()
+
+	if c.aof != nil {
+		if err := c.aof.close(); err != nil {
+			c.aof.fail(errors.Wrap(ErrAOFWrite, err.Error()))
+		}
+	}
 }
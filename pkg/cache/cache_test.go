@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -53,6 +55,33 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestFlush(t *testing.T) {
+	type Test struct {
+		key   string
+		value string
+	}
+
+	tests := []Test{
+		{"key11", "val11"},
+		{"key12", "val12"},
+		{"key13", "val13"},
+	}
+
+	cache := New()
+
+	for _, test := range tests {
+		cache.Set(test.key, test.value, TTL)
+	}
+
+	cache.Flush()
+
+	for _, test := range tests {
+		if gotVal, gotOk := cache.Get(test.key); gotVal != "" || gotOk != false {
+			t.Errorf("cache.Get(%q) = %q, %t, want %q, %t", test.key, gotVal, gotOk, "", false)
+		}
+	}
+}
+
 func TestTTL(t *testing.T) {
 	type Test struct {
 		key   string
@@ -136,3 +165,327 @@ func TestCache(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestJanitor(t *testing.T) {
+	const items = 1000
+
+	cache := New(WithJanitorInterval(10*time.Millisecond), WithJanitorBudget(time.Second))
+	defer cache.Close()
+
+	for i := 0; i < items; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "val", 10*time.Millisecond)
+	}
+	cache.Set("persistent", "val", 0)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		left := cacheLen(cache)
+		if left == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cacheLen(cache) = %d, want %d", left, 1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if gotVal, gotOk := cache.Get("persistent"); gotVal != "val" || gotOk != true {
+		t.Errorf("cache.Get(%q) = %q, %t, want %q, %t", "persistent", gotVal, gotOk, "val", true)
+	}
+}
+
+func TestClose(t *testing.T) {
+	cache := New(WithJanitorInterval(time.Millisecond))
+
+	cache.Close()
+	cache.Close()
+}
+
+func TestMaxEntries(t *testing.T) {
+	cache := New(WithMaxEntries(2))
+
+	// the keys are in one shard, so their order is kept by one policy
+	keys := shardKeys(cache, 3)
+	cache.Set(keys[0], "val1", 0)
+	cache.Set(keys[1], "val2", 0)
+	cache.Get(keys[0])
+	cache.Set(keys[2], "val3", 0)
+
+	if _, gotOk := cache.Get(keys[1]); gotOk != false {
+		t.Errorf("cache.Get(%q) = %t, want %t", keys[1], gotOk, false)
+	}
+	for _, key := range []string{keys[0], keys[2]} {
+		if _, gotOk := cache.Get(key); gotOk != true {
+			t.Errorf("cache.Get(%q) = %t, want %t", key, gotOk, true)
+		}
+	}
+	if got := cache.Evictions(); got != 1 {
+		t.Errorf("cache.Evictions() = %d, want %d", got, 1)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	const items = 10
+
+	value := strings.Repeat("v", 100)
+	// all keys are of the same length, so any 10 of them fit the limit
+	size := int64(len("key00") + len(value) + entryOverhead)
+
+	cache := New(WithMaxBytes(size * items))
+
+	for i := 0; i < 2*items; i++ {
+		cache.Set(fmt.Sprintf("key%02d", i), value, 0)
+	}
+	for i := 0; i < items; i++ {
+		cache.Set(fmt.Sprintf("new%02d", i), value, 0)
+	}
+
+	if stats := cache.Stats(); stats.Bytes > size*items || stats.Entries != items {
+		t.Errorf("cache bytes = %d, items = %d, want <= %d, %d", stats.Bytes, stats.Entries, size*items, items)
+	}
+	if _, gotOk := cache.Get("new09"); gotOk != true {
+		t.Errorf("cache.Get(%q) = %t, want %t", "new09", gotOk, true)
+	}
+
+	evictions := cache.Evictions()
+	cache.Set("huge", strings.Repeat("v", int(size*items)), 0)
+	if _, gotOk := cache.Get("huge"); gotOk != false {
+		t.Errorf("cache.Get(%q) = %t, want %t", "huge", gotOk, false)
+	}
+	if got := cache.Evictions(); got != evictions+1 {
+		t.Errorf("cache.Evictions() = %d, want %d", got, evictions+1)
+	}
+}
+
+func TestLimitsAcrossShards(t *testing.T) {
+	const (
+		items    = 100
+		maxBytes = 1 << 20
+	)
+
+	cache := New(WithMaxEntries(items), WithShards(64))
+
+	for i := 0; i < 10*items; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "val", 0)
+		if _, gotOk := cache.Get(fmt.Sprintf("key%d", i)); gotOk != true {
+			t.Fatalf("cache.Get(%q) = %t, want %t", fmt.Sprintf("key%d", i), gotOk, true)
+		}
+	}
+
+	if stats := cache.Stats(); stats.Entries != items || stats.Evictions != 9*items {
+		t.Errorf("cache items = %d, evictions = %d, want %d, %d", stats.Entries, stats.Evictions, items, 9*items)
+	}
+
+	// the item is much bigger than a share of a shard, but fits the cache
+	cache = New(WithMaxBytes(maxBytes), WithShards(64))
+	big := strings.Repeat("v", 100<<10)
+
+	for i := 0; i < 2*maxBytes/(100+entryOverhead); i++ {
+		cache.Set(fmt.Sprintf("key%d", i), strings.Repeat("v", 100), 0)
+	}
+	cache.Set("big", big, 0)
+
+	if gotVal, gotOk := cache.Get("big"); gotVal != big || gotOk != true {
+		t.Errorf("cache.Get(%q) = %d bytes, %t, want %d bytes, %t", "big", len(gotVal), gotOk, len(big), true)
+	}
+	if stats := cache.Stats(); stats.Bytes > maxBytes || stats.Bytes < maxBytes-int64(len(big)) {
+		t.Errorf("cache bytes = %d, want in [%d, %d]", stats.Bytes, maxBytes-len(big), maxBytes)
+	}
+}
+
+func TestFlushBounded(t *testing.T) {
+	const items = 10
+
+	cache := New(WithMaxEntries(items), WithMaxBytes(items*(10+entryOverhead)))
+
+	for i := 0; i < items; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "val", 0)
+	}
+	cache.Flush()
+
+	for i := 0; i < items; i++ {
+		cache.Set(fmt.Sprintf("new%d", i), "val", 0)
+	}
+
+	for i := 0; i < items; i++ {
+		if _, gotOk := cache.Get(fmt.Sprintf("new%d", i)); gotOk != true {
+			t.Errorf("cache.Get(%q) = %t, want %t", fmt.Sprintf("new%d", i), gotOk, true)
+		}
+	}
+	if got := cache.Evictions(); got != 0 {
+		t.Errorf("cache.Evictions() = %d, want %d", got, 0)
+	}
+	if got, want := cache.budget.entries.Load(), int64(items); got != want {
+		t.Errorf("budget entries = %d, want %d", got, want)
+	}
+}
+
+func TestShards(t *testing.T) {
+	const items = 1000
+
+	cache := New(WithShards(6), WithMaxEntries(items))
+
+	if got := len(cache.shards); got != 8 {
+		t.Fatalf("len(cache.shards) = %d, want %d", got, 8)
+	}
+
+	for i := 0; i < items; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), "val", 0)
+	}
+
+	for i, s := range cache.shards {
+		if len(s.data) == 0 {
+			t.Errorf("shard %d is empty", i)
+		}
+	}
+	if got := cacheLen(cache) + int(cache.Evictions()); got != items {
+		t.Errorf("items + evictions = %d, want %d", got, items)
+	}
+
+	cache.Flush()
+
+	if got := cacheLen(cache); got != 0 {
+		t.Errorf("cacheLen(cache) = %d, want %d", got, 0)
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+
+	cache := New(WithMaxEntries(2), WithShards(1), WithJanitorInterval(10*time.Millisecond))
+	defer cache.Close()
+
+	cache.OnEvict(func(key, value string, reason EvictReason) {
+		mu.Lock()
+		got = append(got, key+"="+value+" "+reason.String())
+		mu.Unlock()
+	})
+
+	cache.Set("key1", "val1", 0)
+	cache.Set("key1", "new1", 0)
+	cache.Set("key2", "val2", time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	cache.Set("key3", "val3", 0)
+	cache.Set("key4", "val4", 0)
+	cache.Delete("key4")
+	cache.Flush()
+
+	want := []string{
+		"key1=val1 replaced",
+		"key2=val2 expired",
+		"key1=new1 capacity",
+		"key4=val4 deleted",
+		"key3=val3 deleted",
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("evicted = %v, want %v", got, want)
+	}
+}
+
+func TestStats(t *testing.T) {
+	cache := New(WithMaxEntries(2), WithShards(1))
+	defer cache.Close()
+
+	cache.Set("key1", "val1", 0)
+	cache.Set("key2", "val2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	cache.Get("key1")
+	cache.Get("key2")
+	cache.Get("key3")
+	cache.Set("key3", "val3", 0)
+	cache.Set("key4", "val4", 0)
+	cache.Delete("key4")
+
+	want := Stats{
+		Hits:          1,
+		Misses:        2,
+		ExpiredOnRead: 1,
+		Evictions:     2,
+		Sets:          4,
+		Deletes:       1,
+		Entries:       1,
+		Bytes:         int64(len("key3") + len("val3") + entryOverhead),
+	}
+	if got := cache.Stats(); got != want {
+		t.Errorf("cache.Stats() = %+v, want %+v", got, want)
+	}
+	if got := cache.Stats().HitRatio(); got != 1.0/3 {
+		t.Errorf("cache.Stats().HitRatio() = %v, want %v", got, 1.0/3)
+	}
+}
+
+// shardKeys returns n keys of the same shard
+func shardKeys(cache *Cache, n int) []string {
+	var keys []string
+	for i := 0; len(keys) < n; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if cache.shard(key) == cache.shard("key0") {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func cacheLen(cache *Cache) int {
+	n := 0
+	for _, s := range cache.shards {
+		s.mu.RLock()
+		n += len(s.data)
+		s.mu.RUnlock()
+	}
+
+	return n
+}
+
+func benchmarkParallelGetSet(b *testing.B, opts ...Option) {
+	const keys = 1 << 16
+
+	cache := New(opts...)
+	defer cache.Close()
+
+	keyNames := make([]string, keys)
+	for i := range keyNames {
+		keyNames[i] = fmt.Sprintf("key%d", i)
+		cache.Set(keyNames[i], "val", 0)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keyNames[i&(keys-1)]
+			// one write per four reads
+			if i&3 == 0 {
+				cache.Set(key, "val", time.Minute)
+			} else {
+				cache.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+// BenchmarkParallelGetSet/single-lock is the cache before sharding
+func BenchmarkParallelGetSet(b *testing.B) {
+	b.Run("single-lock", func(b *testing.B) {
+		benchmarkParallelGetSet(b, WithShards(1))
+	})
+	b.Run("sharded", func(b *testing.B) {
+		benchmarkParallelGetSet(b)
+	})
+	b.Run("single-lock-bounded", func(b *testing.B) {
+		benchmarkParallelGetSet(b, WithShards(1), WithMaxEntries(1<<15))
+	})
+	b.Run("sharded-bounded", func(b *testing.B) {
+		benchmarkParallelGetSet(b, WithMaxEntries(1<<15))
+	})
+}
@@ -0,0 +1,21 @@
+package cache
+
+import "github.com/pkg/errors"
+
+var (
+	ErrUnknownPolicy      = errors.New("cache: unknown eviction policy")
+	ErrSnapshotDisabled   = errors.New("cache: snapshot file is not configured")
+	ErrSnapshotWrite      = errors.New("cache: unable to write snapshot")
+	ErrSnapshotRead       = errors.New("cache: unable to read snapshot")
+	ErrSnapshotFormat     = errors.New("cache: bad snapshot format")
+	ErrSnapshotVersion    = errors.New("cache: unsupported snapshot version")
+	ErrSnapshotChecksum   = errors.New("cache: snapshot checksum mismatch")
+	ErrAOFDisabled        = errors.New("cache: append-only log file is not configured")
+	ErrAOFOpen            = errors.New("cache: unable to open append-only log")
+	ErrAOFFormat          = errors.New("cache: bad append-only log format")
+	ErrAOFWrite           = errors.New("cache: unable to write append-only log")
+	ErrAOFRewrite         = errors.New("cache: unable to rewrite append-only log")
+	ErrUnknownFsyncPolicy = errors.New("cache: unknown fsync policy")
+	ErrNotInteger         = errors.New("cache: value is not an integer")
+	ErrOverflow           = errors.New("cache: increment would overflow")
+)
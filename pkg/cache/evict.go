@@ -0,0 +1,95 @@
+package cache
+
+type EvictReason int
+
+const (
+	// EvictExpired - ttl of the item has expired
+	EvictExpired EvictReason = iota
+	// EvictCapacity - the item is evicted by eviction policy to fit the cache limits
+	EvictCapacity
+	// EvictDeleted - the item is deleted by Delete or Flush
+	EvictDeleted
+	// EvictReplaced - the item is overwritten by Set
+	EvictReplaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeleted:
+		return "deleted"
+	case EvictReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// EvictFunc is called for every item removed from the cache
+type EvictFunc[K comparable, V any] func(key K, value V, reason EvictReason)
+
+type evictedEntry[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+// OnEvict sets a function called for every removed item, it replaces the previous one, nil removes it.
+// The function is called after the cache lock is released, in the goroutine which removed the item:
+// Set, Delete, Flush or the janitor for expired items. An expired item which is neither
+// removed by the janitor nor overwritten or deleted stays in the cache and is not reported.
+// Items replaced while loading a snapshot or replaying append-only log are not reported
+func (c *TypedCache[K, V]) OnEvict(fn EvictFunc[K, V]) {
+	if fn == nil {
+		c.onEvict.Store(nil)
+		return
+	}
+
+	c.onEvict.Store(&fn)
+}
+
+// notify calls eviction function for removed items, no lock must be held
+func (c *TypedCache[K, V]) notify(evicted []evictedEntry[K, V]) {
+	if len(evicted) == 0 {
+		return
+	}
+
+	fn := c.onEvict.Load()
+	if fn == nil {
+		return
+	}
+
+	for _, e := range evicted {
+		(*fn)(e.key, e.value, e.reason)
+	}
+}
+
+// evictedLocked reports removed item to the observer and appends it to evicted when eviction
+// function is set, an expired item is reported as expired whatever removed it
+func (s *shard[K, V]) evictedLocked(evicted []evictedEntry[K, V], key K, item item[K, V], reason EvictReason, now int64) []evictedEntry[K, V] {
+	if item.expired(now) {
+		reason = EvictExpired
+	}
+
+	if s.observed() {
+		s.observer.removed(key, item.value, reason)
+	}
+
+	if s.onEvict.Load() == nil {
+		return evicted
+	}
+
+	return append(evicted, evictedEntry[K, V]{key: key, value: item.value, reason: reason})
+}
+
+// reporting reports whether removed items are reported anywhere
+func (s *shard[K, V]) reporting() bool {
+	return s.onEvict.Load() != nil || s.observed()
+}
+
+func (s *shard[K, V]) observed() bool {
+	return s.observer != nil && s.observer.active()
+}
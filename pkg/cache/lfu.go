@@ -0,0 +1,101 @@
+package cache
+
+import "container/list"
+
+// lfu evicts the least frequently used key, keys with the same frequency
+// are evicted in least recently used order. Keys are kept in lists by frequency,
+// so all operations are O(1)
+type lfu[K comparable] struct {
+	entries map[K]*lfuEntry[K]
+	buckets map[int]*list.List
+	minFreq int
+}
+
+type lfuEntry[K comparable] struct {
+	key  K
+	freq int
+	elem *list.Element
+}
+
+func NewLFUPolicy(capacity int) Policy {
+	return NewLFUKeyPolicy[string](capacity)
+}
+
+// NewLFUKeyPolicy is NewLFUPolicy for keys of any type
+func NewLFUKeyPolicy[K comparable](_ int) KeyPolicy[K] {
+	return &lfu[K]{
+		entries: make(map[K]*lfuEntry[K]),
+		buckets: make(map[int]*list.List),
+	}
+}
+
+func (l *lfu[K]) Add(key K) {
+	if _, ok := l.entries[key]; ok {
+		l.Access(key)
+		return
+	}
+
+	e := &lfuEntry[K]{key: key, freq: 1}
+	e.elem = l.bucket(1).PushFront(e)
+	l.entries[key] = e
+	l.minFreq = 1
+}
+
+func (l *lfu[K]) Access(key K) {
+	e, ok := l.entries[key]
+	if !ok {
+		return
+	}
+
+	l.unlink(e)
+	if e.freq == l.minFreq && l.buckets[e.freq] == nil {
+		l.minFreq++
+	}
+
+	e.freq++
+	e.elem = l.bucket(e.freq).PushFront(e)
+}
+
+func (l *lfu[K]) Remove(key K) {
+	e, ok := l.entries[key]
+	if !ok {
+		return
+	}
+
+	l.unlink(e)
+	delete(l.entries, key)
+}
+
+func (l *lfu[K]) Victim() (K, bool) {
+	if len(l.entries) == 0 {
+		var zero K
+		return zero, false
+	}
+
+	// minFreq may point to a bucket emptied by Remove
+	for l.buckets[l.minFreq] == nil {
+		l.minFreq++
+	}
+
+	return l.buckets[l.minFreq].Back().Value.(*lfuEntry[K]).key, true
+}
+
+func (l *lfu[K]) bucket(freq int) *list.List {
+	b, ok := l.buckets[freq]
+	if !ok {
+		b = list.New()
+		l.buckets[freq] = b
+	}
+
+	return b
+}
+
+// unlink removes entry from its bucket, empty buckets are dropped
+func (l *lfu[K]) unlink(e *lfuEntry[K]) {
+	b := l.buckets[e.freq]
+	b.Remove(e.elem)
+
+	if b.Len() == 0 {
+		delete(l.buckets, e.freq)
+	}
+}
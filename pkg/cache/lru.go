@@ -0,0 +1,53 @@
+package cache
+
+import "container/list"
+
+// lru tracks keys in order of use, the least recently used key is evicted first
+type lru[K comparable] struct {
+	ll    *list.List
+	elems map[K]*list.Element
+}
+
+func NewLRUPolicy(capacity int) Policy {
+	return NewLRUKeyPolicy[string](capacity)
+}
+
+// NewLRUKeyPolicy is NewLRUPolicy for keys of any type
+func NewLRUKeyPolicy[K comparable](_ int) KeyPolicy[K] {
+	return &lru[K]{
+		ll:    list.New(),
+		elems: make(map[K]*list.Element),
+	}
+}
+
+func (l *lru[K]) Add(key K) {
+	if elem, ok := l.elems[key]; ok {
+		l.ll.MoveToFront(elem)
+		return
+	}
+
+	l.elems[key] = l.ll.PushFront(key)
+}
+
+func (l *lru[K]) Access(key K) {
+	if elem, ok := l.elems[key]; ok {
+		l.ll.MoveToFront(elem)
+	}
+}
+
+func (l *lru[K]) Remove(key K) {
+	if elem, ok := l.elems[key]; ok {
+		l.ll.Remove(elem)
+		delete(l.elems, key)
+	}
+}
+
+func (l *lru[K]) Victim() (K, bool) {
+	elem := l.ll.Back()
+	if elem == nil {
+		var zero K
+		return zero, false
+	}
+
+	return elem.Value.(K), true
+}
@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"runtime"
+	"time"
+)
+
+type Option func(*options)
+
+// TypedOption is an option of TypedCache with keys of type K and values of type V,
+// options shared with Cache are passed to TypedCache with WithOptions
+type TypedOption[K comparable, V any] func(*typedOptions[K, V])
+
+// options are shared by Cache and TypedCache, eviction policy, snapshot
+// and append-only log options are used by Cache only
+type options struct {
+	shardsNum        int
+	policy           NewPolicyFunc
+	maxEntries       int
+	maxBytes         int64
+	janitorInterval  time.Duration
+	janitorBatchSize int
+	janitorBudget    time.Duration
+
+	snapshotFile         string
+	snapshotInterval     time.Duration
+	snapshotErrorHandler func(error)
+
+	aofFile           string
+	aofFsync          FsyncPolicy
+	aofRewriteMinSize int64
+	aofErrorHandler   func(error)
+
+	subscriptionBuffer   int
+	slowSubscriberPolicy SlowSubscriberPolicy
+
+	orderedIndex bool
+}
+
+// typedOptions are options of TypedCache which depend on its key and value types
+type typedOptions[K comparable, V any] struct {
+	options
+
+	newPolicy func(capacity int) KeyPolicy[K]
+	sizeFunc  func(key K, value V) int64
+	keyHash   func(key K) uint64
+}
+
+func getDefaultOptions() options {
+	return options{
+		shardsNum:          shardsPerProc * runtime.GOMAXPROCS(0),
+		janitorBatchSize:   defaultJanitorBatchSize,
+		aofRewriteMinSize:  defaultAOFRewriteMinSize,
+		subscriptionBuffer: defaultSubscriptionBuffer,
+	}
+}
+
+// WithJanitorInterval sets how often expired items are removed in background, it is also
+// the resolution of the timer wheel which tracks ttl, if 0 - expired items are only hidden by Get
+func WithJanitorInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.janitorInterval = interval
+	}
+}
+
+// WithJanitorBatchSize sets how many expired items are removed under one write lock of a shard
+func WithJanitorBatchSize(batchSize int) Option {
+	return func(o *options) {
+		o.janitorBatchSize = batchSize
+	}
+}
+
+// WithJanitorBudget limits how long one janitor run may take, by default it's a quarter of the interval
+func WithJanitorBudget(budget time.Duration) Option {
+	return func(o *options) {
+		o.janitorBudget = budget
+	}
+}
+
+// WithMaxEntries bounds the number of items, items chosen by eviction policy are evicted
+// when the limit is hit, if 0 - unlimited
+func WithMaxEntries(maxEntries int) Option {
+	return func(o *options) {
+		o.maxEntries = maxEntries
+	}
+}
+
+// WithMaxBytes bounds approximate memory used by keys, values and per-item overhead,
+// items chosen by eviction policy are evicted when the limit is hit, if 0 - unlimited
+func WithMaxBytes(maxBytes int64) Option {
+	return func(o *options) {
+		o.maxBytes = maxBytes
+	}
+}
+
+// WithPolicy sets eviction policy of the bounded cache, LRU by default,
+// TypedCache takes its policy from WithKeyPolicy
+func WithPolicy(newPolicy NewPolicyFunc) Option {
+	return func(o *options) {
+		o.policy = newPolicy
+	}
+}
+
+// WithOptions passes options shared with Cache to TypedCache
+func WithOptions[K comparable, V any](opts ...Option) TypedOption[K, V] {
+	return func(o *typedOptions[K, V]) {
+		for _, opt := range opts {
+			opt(&o.options)
+		}
+	}
+}
+
+// WithKeyPolicy sets eviction policy of the bounded TypedCache, LRU by default
+func WithKeyPolicy[K comparable, V any](newPolicy func(capacity int) KeyPolicy[K]) TypedOption[K, V] {
+	return func(o *typedOptions[K, V]) {
+		o.newPolicy = newPolicy
+	}
+}
+
+// WithSizeFunc sets the function which estimates memory used by a key and a value
+// of TypedCache for WithMaxBytes, per-item overhead is added to it. By default only
+// strings and byte slices are measured
+func WithSizeFunc[K comparable, V any](size func(key K, value V) int64) TypedOption[K, V] {
+	return func(o *typedOptions[K, V]) {
+		o.sizeFunc = size
+	}
+}
+
+// WithKeyHash sets the function which spreads keys of TypedCache between shards.
+// By default strings and integers are hashed directly and other keys by their fmt
+// representation, so keys like structs and floats should have their own hash
+func WithKeyHash[K comparable, V any](hash func(key K) uint64) TypedOption[K, V] {
+	return func(o *typedOptions[K, V]) {
+		o.keyHash = hash
+	}
+}
+
+// WithShards sets the number of shards, it is rounded up to a power of two,
+// by default it's 4 shards per GOMAXPROCS
+func WithShards(shards int) Option {
+	return func(o *options) {
+		o.shardsNum = shards
+	}
+}
+
+// WithSnapshotFile sets the file Snapshot writes to and LoadSnapshot reads from
+func WithSnapshotFile(path string) Option {
+	return func(o *options) {
+		o.snapshotFile = path
+	}
+}
+
+// WithSnapshotInterval sets how often snapshots are written in background,
+// if 0 - only on demand
+func WithSnapshotInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.snapshotInterval = interval
+	}
+}
+
+// WithSnapshotErrorHandler sets a function called when a background snapshot fails
+func WithSnapshotErrorHandler(handler func(error)) Option {
+	return func(o *options) {
+		o.snapshotErrorHandler = handler
+	}
+}
+
+// WithAOFFile sets append-only log file, OpenAOF replays it and starts logging changes
+func WithAOFFile(path string) Option {
+	return func(o *options) {
+		o.aofFile = path
+	}
+}
+
+// WithAOFFsync sets how often append-only log is synced to disk, every second by default
+func WithAOFFsync(policy FsyncPolicy) Option {
+	return func(o *options) {
+		o.aofFsync = policy
+	}
+}
+
+// WithAOFRewriteMinSize sets the log size from which the log is rewritten in background
+// when it has doubled since the last rewrite, if 0 - only on demand
+func WithAOFRewriteMinSize(size int64) Option {
+	return func(o *options) {
+		o.aofRewriteMinSize = size
+	}
+}
+
+// WithAOFErrorHandler sets a function called when append-only log can't be written in background
+func WithAOFErrorHandler(handler func(error)) Option {
+	return func(o *options) {
+		o.aofErrorHandler = handler
+	}
+}
+
+// WithSubscriptionBuffer sets how many events a subscription buffers for its subscriber, 1024 by default
+func WithSubscriptionBuffer(size int) Option {
+	return func(o *options) {
+		o.subscriptionBuffer = size
+	}
+}
+
+// WithSlowSubscriberPolicy sets what happens when a subscription buffer is full,
+// events are dropped by default
+func WithSlowSubscriberPolicy(policy SlowSubscriberPolicy) Option {
+	return func(o *options) {
+		o.slowSubscriberPolicy = policy
+	}
+}
+
+// WithOrderedIndex keeps keys of Cache ordered, so Scan seeks to the cursor instead of a pass
+// over all keys, it costs O(log n) per write and memory of the index
+func WithOrderedIndex(enabled bool) Option {
+	return func(o *options) {
+		o.orderedIndex = enabled
+	}
+}
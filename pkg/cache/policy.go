@@ -0,0 +1,42 @@
+package cache
+
+import "github.com/pkg/errors"
+
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// KeyPolicy decides which item is evicted when the bounded cache is over its limits.
+// Policies are not safe for concurrent use, the cache calls them under its lock
+type KeyPolicy[K comparable] interface {
+	// Add records a new key
+	Add(key K)
+	// Access records a hit of the key
+	Access(key K)
+	// Remove forgets the key
+	Remove(key K)
+	// Victim returns the key to evict, the policy keeps tracking it until Remove
+	Victim() (K, bool)
+}
+
+// Policy is eviction policy of string keys
+type Policy = KeyPolicy[string]
+
+// NewPolicyFunc creates policy for a cache of capacity items, capacity is 0 when only bytes are bounded
+type NewPolicyFunc func(capacity int) Policy
+
+// ParsePolicy returns policy constructor by its name
+func ParsePolicy(name string) (NewPolicyFunc, error) {
+	switch name {
+	case PolicyLRU:
+		return NewLRUPolicy, nil
+	case PolicyLFU:
+		return NewLFUPolicy, nil
+	case PolicyTinyLFU:
+		return NewTinyLFUPolicy, nil
+	default:
+		return nil, errors.Wrap(ErrUnknownPolicy, name)
+	}
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	traceLength   = 200_000
+	traceKeys     = 50_000
+	traceCapacity = 2_000
+	scanEvery     = 10_000
+	scanLength    = 5_000
+)
+
+var policies = map[string]NewPolicyFunc{
+	PolicyLRU:     NewLRUPolicy,
+	PolicyLFU:     NewLFUPolicy,
+	PolicyTinyLFU: NewTinyLFUPolicy,
+}
+
+func TestPolicyVictim(t *testing.T) {
+	type Test struct {
+		policy NewPolicyFunc
+		want   string
+	}
+
+	// key1 is hit twice, key2 is added before key3
+	tests := map[string]Test{
+		PolicyLRU:     {NewLRUPolicy, "key2"},
+		PolicyLFU:     {NewLFUPolicy, "key2"},
+		PolicyTinyLFU: {NewTinyLFUPolicy, "key2"},
+	}
+
+	for name, test := range tests {
+		p := test.policy(3)
+		p.Add("key1")
+		p.Add("key2")
+		p.Add("key3")
+		p.Access("key1")
+		p.Access("key1")
+		p.Access("key3")
+
+		if got, ok := p.Victim(); got != test.want || !ok {
+			t.Errorf("%s: p.Victim() = %q, %t, want %q, %t", name, got, ok, test.want, true)
+		}
+
+		p.Remove("key1")
+		p.Remove("key2")
+		p.Remove("key3")
+
+		if got, ok := p.Victim(); ok {
+			t.Errorf("%s: p.Victim() = %q, %t, want %q, %t", name, got, ok, "", false)
+		}
+	}
+}
+
+func TestPolicyScanResistance(t *testing.T) {
+	const (
+		capacity = 100
+		hotKeys  = 50
+	)
+
+	for _, name := range []string{PolicyLFU, PolicyTinyLFU} {
+		cache := New(WithMaxEntries(capacity), WithPolicy(policies[name]))
+
+		for i := 0; i < hotKeys; i++ {
+			cache.Set(fmt.Sprintf("hot%d", i), "val", 0)
+		}
+		for n := 0; n < 10; n++ {
+			for i := 0; i < hotKeys; i++ {
+				cache.Get(fmt.Sprintf("hot%d", i))
+			}
+		}
+		for i := 0; i < 10*capacity; i++ {
+			cache.Set(fmt.Sprintf("scan%d", i), "val", 0)
+		}
+
+		survived := 0
+		for i := 0; i < hotKeys; i++ {
+			if _, ok := cache.Get(fmt.Sprintf("hot%d", i)); ok {
+				survived++
+			}
+		}
+
+		if survived < hotKeys*9/10 {
+			t.Errorf("%s: %d of %d hot keys survived scan, want at least %d", name, survived, hotKeys, hotKeys*9/10)
+		}
+	}
+}
+
+// zipfTrace is a skewed workload of popular keys
+func zipfTrace() []string {
+	r := rand.New(rand.NewSource(1))
+	z := rand.NewZipf(r, 1.01, 1, traceKeys-1)
+
+	trace := make([]string, traceLength)
+	for i := range trace {
+		trace[i] = fmt.Sprintf("key%d", z.Uint64())
+	}
+
+	return trace
+}
+
+// scanTrace is zipf workload interrupted by scans of keys which are used once
+func scanTrace() []string {
+	trace := zipfTrace()
+
+	scan := 0
+	for i := scanEvery; i+scanLength < len(trace); i += scanEvery + scanLength {
+		for j := i; j < i+scanLength; j++ {
+			trace[j] = fmt.Sprintf("scan%d", scan)
+			scan++
+		}
+	}
+
+	return trace
+}
+
+// loadTraces reads recorded traces from testdata/traces/*.trace, one key per line
+func loadTraces(b *testing.B) map[string][]string {
+	traces := map[string][]string{
+		"zipf": zipfTrace(),
+		"scan": scanTrace(),
+	}
+
+	files, _ := filepath.Glob(filepath.Join("testdata", "traces", "*.trace"))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			b.Fatalf("unable to open trace: %v", err)
+		}
+
+		var trace []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if key := strings.TrimSpace(scanner.Text()); key != "" {
+				trace = append(trace, key)
+			}
+		}
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			b.Fatalf("unable to read trace: %v", err)
+		}
+
+		traces[strings.TrimSuffix(filepath.Base(file), ".trace")] = trace
+	}
+
+	return traces
+}
+
+// BenchmarkPolicyHitRatio replays traces against the bounded cache and reports hit ratio,
+// a miss is followed by Set like a read-through cache does
+func BenchmarkPolicyHitRatio(b *testing.B) {
+	traces := loadTraces(b)
+
+	for traceName, trace := range traces {
+		for policyName, policy := range policies {
+			b.Run(traceName+"/"+policyName, func(b *testing.B) {
+				var hits, requests int
+
+				for n := 0; n < b.N; n++ {
+					cache := New(WithMaxEntries(traceCapacity), WithPolicy(policy))
+
+					for _, key := range trace {
+						if _, ok := cache.Get(key); ok {
+							hits++
+						} else {
+							cache.Set(key, key, 0)
+						}
+					}
+					requests += len(trace)
+				}
+
+				b.ReportMetric(100*float64(hits)/float64(requests), "hit%")
+			})
+		}
+	}
+}
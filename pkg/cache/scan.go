@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is a key-value pair returned by Scan
+type Entry struct {
+	Key   string
+	Value string
+	// TTL is the remaining time to live, 0 - no expire time
+	TTL time.Duration
+}
+
+// Scan returns up to limit entries with the prefix in key order starting after the cursor,
+// the empty cursor starts a new scan. next is the cursor of the following call, it is empty
+// when the scan is complete. Keys are ordered, so a key which exists during the whole scan
+// is returned exactly once even while the cache is written, keys set or deleted meanwhile
+// may be returned or not. Expired entries are skipped
+func (c *Cache) Scan(cursor, prefix string, limit int) (entries []Entry, next string) {
+	if limit <= 0 {
+		return nil, ""
+	}
+
+	// the first page includes the start key itself, the next ones start after the cursor
+	start, inclusive := prefix, true
+	if cursor != "" && cursor >= prefix {
+		start, inclusive = cursor, false
+	}
+
+	now := nanotime()
+	for i, s := range c.shards {
+		if c.indexes != nil {
+			entries = append(entries, scanIndex(s, c.indexes[i], start, inclusive, prefix, limit, now)...)
+		} else {
+			entries = append(entries, scanShard(s, start, inclusive, prefix, limit, now)...)
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	if len(entries) < limit {
+		return entries, ""
+	}
+
+	entries = entries[:limit]
+
+	return entries, entries[limit-1].Key
+}
+
+// setIndexes creates ordered indexes of the shards, all shards are locked like in Flush
+func (c *Cache) setIndexes() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+	}
+
+	c.indexes = make([]*skipList, len(c.shards))
+	for i, s := range c.shards {
+		c.indexes[i] = newSkipList()
+		for key := range s.data {
+			c.indexes[i].insert(key)
+		}
+		s.index = c.indexes[i]
+		s.mu.Unlock()
+	}
+}
+
+// scanIndex returns up to limit first entries of the shard from start walking its ordered index
+func scanIndex(s *shard[string, string], index *skipList, start string, inclusive bool, prefix string, limit int, now int64) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []Entry
+
+	for n := index.seek(start); n != nil && len(entries) < limit; n = n.next[0] {
+		if !strings.HasPrefix(n.key, prefix) {
+			break
+		}
+		if !inclusive && n.key == start {
+			continue
+		}
+
+		item := s.data[n.key]
+		if item.expired(now) {
+			continue
+		}
+
+		entries = append(entries, Entry{Key: n.key, Value: item.value, TTL: item.ttl(now)})
+	}
+
+	return entries
+}
+
+// scanShard returns up to limit first entries of the shard from start without the index,
+// all keys of the shard are visited
+func scanShard(s *shard[string, string], start string, inclusive bool, prefix string, limit int, now int64) []Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []Entry
+
+	for key, item := range s.data {
+		if key < start || (!inclusive && key == start) || !strings.HasPrefix(key, prefix) || item.expired(now) {
+			continue
+		}
+
+		entries = append(entries, Entry{Key: key, Value: item.value, TTL: item.ttl(now)})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func scanAll(c *Cache, prefix string, limit int) []string {
+	var keys []string
+
+	cursor := ""
+	for {
+		entries, next := c.Scan(cursor, prefix, limit)
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+		}
+		if next == "" {
+			return keys
+		}
+		cursor = next
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indexed=%v", indexed), func(t *testing.T) {
+			cache := New(WithShards(4), WithOrderedIndex(indexed))
+			defer cache.Close()
+
+			var want []string
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("user:%03d", i)
+				cache.Set(key, "val", 0)
+				want = append(want, key)
+			}
+			cache.Set("other", "val", 0)
+			cache.Set("user:expired", "val", time.Nanosecond)
+			cache.Set("user:ttl", "val", time.Hour)
+			want = append(want, "user:ttl")
+			cache.Delete("user:050")
+			want = append(want[:50], want[51:]...)
+
+			time.Sleep(time.Millisecond)
+
+			got := scanAll(cache, "user:", 7)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("keys = %v, want %v", got, want)
+			}
+
+			entries, next := cache.Scan("user:098", "user:", 10)
+			if next != "" || len(entries) != 2 || entries[1].Key != "user:ttl" {
+				t.Fatalf("Scan() = %v, %q, want 2 entries and empty cursor", entries, next)
+			}
+			if entries[1].TTL <= 0 || entries[1].TTL > time.Hour || entries[0].TTL != 0 {
+				t.Errorf("ttl = %v, %v", entries[0].TTL, entries[1].TTL)
+			}
+
+			if got := len(scanAll(cache, "", 1000)); got != len(want)+1 {
+				t.Errorf("all keys = %d, want %d", got, len(want)+1)
+			}
+
+			cache.Flush()
+			if entries, next := cache.Scan("", "", 10); len(entries) != 0 || next != "" {
+				t.Errorf("Scan() after flush = %v, %q", entries, next)
+			}
+		})
+	}
+}
+
+func TestScanConcurrentWrites(t *testing.T) {
+	cache := New(WithShards(4), WithOrderedIndex(true))
+	defer cache.Close()
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(fmt.Sprintf("key:%04d", i), "val", 0)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			key := fmt.Sprintf("key:%04d.tmp", i%1000)
+			cache.Set(key, "val", 0)
+			cache.Delete(key)
+		}
+	}()
+
+	seen := make(map[string]int)
+	for _, key := range scanAll(cache, "key:", 16) {
+		seen[key]++
+	}
+	close(done)
+	wg.Wait()
+
+	for i := 0; i < 1000; i++ {
+		if n := seen[fmt.Sprintf("key:%04d", i)]; n != 1 {
+			t.Fatalf("key:%04d is returned %d times, want once", i, n)
+		}
+	}
+}
+
+func TestSkipList(t *testing.T) {
+	l := newSkipList()
+	for _, key := range []string{"c", "a", "e", "b", "d", "a"} {
+		l.insert(key)
+	}
+	l.remove("c")
+	l.remove("x")
+
+	var keys []string
+	for n := l.seek("b"); n != nil; n = n.next[0] {
+		keys = append(keys, n.key)
+	}
+
+	if fmt.Sprint(keys) != "[b d e]" || l.len != 4 {
+		t.Errorf("keys = %v, len = %d, want [b d e], 4", keys, l.len)
+	}
+}
@@ -0,0 +1,424 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shard is a part of the cache with its own lock, items and eviction accounting
+type shard[K comparable, V any] struct {
+	mu   sync.RWMutex
+	data map[K]item[K, V]
+
+	// policy and budget are nil when the cache is not bounded
+	policy    KeyPolicy[K]
+	budget    *budget
+	newPolicy func(capacity int) KeyPolicy[K]
+	size      func(key K, value V) int64
+	// maxEntries and maxBytes are the share of the cache limits,
+	// the shard exceeds it only while the whole cache is under its limits
+	maxEntries int
+	maxBytes   int64
+	// bytes is tracked for stats when the shard is not bounded too
+	bytes int64
+	stats shardStats
+
+	// wheel is nil when the janitor is off
+	wheel *timerWheel[K]
+	// log is nil when append-only log is disabled
+	log changeLog[K, V]
+	// observer is nil unless Cache has set it for subscriptions
+	observer changeObserver[K, V]
+	// index is nil unless Cache keeps keys ordered for Scan
+	index keyIndex[K]
+	// onEvict is shared by all shards of the cache
+	onEvict *atomic.Pointer[EvictFunc[K, V]]
+}
+
+// changeLog records changes of shards under the lock of the changed shard
+type changeLog[K comparable, V any] interface {
+	set(key K, value V, ttl time.Duration)
+	delete(key K)
+	flush()
+}
+
+// changeObserver gets changes of shards under the lock of the changed shard, so changes
+// of a key come in the order they were applied in, it must not block
+type changeObserver[K comparable, V any] interface {
+	// active reports whether changes should be reported
+	active() bool
+	set(key K, value V)
+	removed(key K, value V, reason EvictReason)
+}
+
+// keyIndex keeps keys of a shard ordered, it is changed under the shard lock
+type keyIndex[K comparable] interface {
+	insert(key K)
+	remove(key K)
+	reset()
+}
+
+func newShard[K comparable, V any](maxEntries int, maxBytes int64, b *budget, newPolicy func(int) KeyPolicy[K], size func(K, V) int64, resolution time.Duration, onEvict *atomic.Pointer[EvictFunc[K, V]]) *shard[K, V] {
+	s := &shard[K, V]{
+		data:       make(map[K]item[K, V]),
+		newPolicy:  newPolicy,
+		size:       size,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		onEvict:    onEvict,
+	}
+
+	if b != nil {
+		s.budget = b
+		s.policy = newPolicy(maxEntries)
+	}
+	if resolution > 0 {
+		s.wheel = newTimerWheel[K](resolution)
+	}
+
+	return s
+}
+
+func (s *shard[K, V]) get(key K) (V, bool) {
+	if s.policy != nil {
+		return s.getAndTouch(key)
+	}
+
+	s.mu.RLock()
+	item, ok := s.data[key]
+	defer s.mu.RUnlock()
+
+	if !s.countRead(item, ok, nanotime()) {
+		var zero V
+		return zero, false
+	}
+
+	return item.value, true
+}
+
+// getAndTouch is get of the bounded shard, it records the hit in eviction policy
+func (s *shard[K, V]) getAndTouch(key K) (V, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.data[key]
+	if !s.countRead(item, ok, nanotime()) {
+		var zero V
+		return zero, false
+	}
+
+	s.policy.Access(key)
+
+	return item.value, true
+}
+
+// set stores the value with ttl, if 0 - no expire time, and returns items it removed
+func (s *shard[K, V]) set(key K, value V, ttl time.Duration) []evictedEntry[K, V] {
+	now := nanotime()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setLocked(nil, key, value, ttl, now)
+}
+
+// setLocked stores the value with ttl and appends items it removed to evicted, s.mu must be held
+func (s *shard[K, V]) setLocked(evicted []evictedEntry[K, V], key K, value V, ttl time.Duration, now int64) []evictedEntry[K, V] {
+	it := item[K, V]{value: value}
+	if ttl > 0 {
+		it.expiresAt = now + int64(ttl)
+	}
+
+	size := s.entrySize(key, it)
+	if s.policy != nil && s.budget.maxBytes > 0 && size > s.budget.maxBytes {
+		return s.rejectLocked(evicted, key, it, now)
+	}
+
+	if s.log != nil {
+		s.log.set(key, value, ttl)
+	}
+
+	if old, ok := s.data[key]; ok {
+		s.removeLocked(key, old)
+		evicted = s.evictedLocked(evicted, key, old, EvictReplaced, now)
+	}
+
+	if s.observed() {
+		s.observer.set(key, value)
+	}
+
+	if it.expiresAt != 0 && s.wheel != nil {
+		it.timer = s.wheel.add(key, it.expiresAt)
+	}
+
+	s.data[key] = it
+	s.bytes += size
+	if s.index != nil {
+		s.index.insert(key)
+	}
+
+	if s.policy == nil {
+		return evicted
+	}
+
+	s.budget.add(1, size)
+	s.policy.Add(key)
+
+	return s.evictLocked(evicted, key)
+}
+
+// rejectLocked drops the item which is bigger than the cache, it is neither logged nor observed,
+// but counted as evicted. The item of the key is evicted too, so the key doesn't keep the value
+// the caller has overwritten, s.mu must be held
+func (s *shard[K, V]) rejectLocked(evicted []evictedEntry[K, V], key K, it item[K, V], now int64) []evictedEntry[K, V] {
+	if _, ok := s.data[key]; ok {
+		if s.log != nil {
+			s.log.delete(key)
+		}
+		evicted = s.evictKeyLocked(evicted, key, now)
+	}
+
+	s.stats.evictions.Add(1)
+	if s.onEvict.Load() == nil {
+		return evicted
+	}
+
+	return append(evicted, evictedEntry[K, V]{key: key, value: it.value, reason: EvictCapacity})
+}
+
+// updateOp is what update does with the item after the update function
+type updateOp int
+
+const (
+	updateNone updateOp = iota
+	updateSet
+	updateDelete
+)
+
+// update calls fn with the value of the key and its remaining ttl under the lock and stores
+// or deletes the item as fn returns. An expired item is removed first and passed as absent
+func (s *shard[K, V]) update(key K, fn func(value V, ttl time.Duration, ok bool) (V, time.Duration, updateOp)) []evictedEntry[K, V] {
+	now := nanotime()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var evicted []evictedEntry[K, V]
+
+	old, ok := s.data[key]
+	if ok && old.expired(now) {
+		s.removeLocked(key, old)
+		evicted = s.evictedLocked(evicted, key, old, EvictExpired, now)
+		ok = false
+	}
+
+	var value V
+	var ttl time.Duration
+	if ok {
+		value = old.value
+		// the remaining ttl of an item which is not expired yet may be 0, that is no expire time
+		if ttl = old.ttl(now); old.expiresAt != 0 && ttl <= 0 {
+			ttl = 1
+		}
+	}
+
+	value, ttl, op := fn(value, ttl, ok)
+
+	switch op {
+	case updateSet:
+		s.stats.sets.Add(1)
+		return s.setLocked(evicted, key, value, ttl, now)
+	case updateDelete:
+		if !ok {
+			return evicted
+		}
+		s.stats.deletes.Add(1)
+		return s.deleteLocked(evicted, key, old, now)
+	default:
+		return evicted
+	}
+}
+
+// delete removes the item and returns it as evicted
+func (s *shard[K, V]) delete(key K) []evictedEntry[K, V] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+
+	return s.deleteLocked(nil, key, item, nanotime())
+}
+
+// deleteLocked removes the item and appends it to evicted as deleted, s.mu must be held
+func (s *shard[K, V]) deleteLocked(evicted []evictedEntry[K, V], key K, item item[K, V], now int64) []evictedEntry[K, V] {
+	if s.log != nil {
+		s.log.delete(key)
+	}
+	s.removeLocked(key, item)
+
+	return s.evictedLocked(evicted, key, item, EvictDeleted, now)
+}
+
+func (s *shard[K, V]) flush() []evictedEntry[K, V] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flushLocked(nil)
+}
+
+// flushLocked removes all items of the shard and appends them to evicted, s.mu must be held
+func (s *shard[K, V]) flushLocked(evicted []evictedEntry[K, V]) []evictedEntry[K, V] {
+	if s.reporting() {
+		now := nanotime()
+		for key, item := range s.data {
+			evicted = s.evictedLocked(evicted, key, item, EvictDeleted, now)
+		}
+	}
+
+	if s.policy != nil {
+		s.budget.add(-len(s.data), -s.bytes)
+		s.policy = s.newPolicy(s.maxEntries)
+	}
+
+	s.data = make(map[K]item[K, V])
+	if s.wheel != nil {
+		s.wheel.reset()
+	}
+	if s.index != nil {
+		s.index.reset()
+	}
+	s.bytes = 0
+
+	return evicted
+}
+
+// countRead counts the read of the item, it reports whether it is a hit
+func (s *shard[K, V]) countRead(item item[K, V], ok bool, now int64) bool {
+	if !ok {
+		s.stats.misses.Add(1)
+		return false
+	}
+
+	if item.expired(now) {
+		s.stats.expiredOnRead.Add(1)
+		s.stats.misses.Add(1)
+		return false
+	}
+
+	s.stats.hits.Add(1)
+
+	return true
+}
+
+// entrySize is approximate memory used by an entry
+func (s *shard[K, V]) entrySize(key K, item item[K, V]) int64 {
+	return s.size(key, item.value) + entryOverhead
+}
+
+// removeLocked removes item and its size accounting, s.mu must be held
+func (s *shard[K, V]) removeLocked(key K, item item[K, V]) {
+	delete(s.data, key)
+	s.bytes -= s.entrySize(key, item)
+	if s.index != nil {
+		s.index.remove(key)
+	}
+
+	if item.timer != nil {
+		s.wheel.remove(item.timer)
+	}
+
+	if s.policy != nil {
+		s.budget.add(-1, -s.entrySize(key, item))
+		s.policy.Remove(key)
+	}
+}
+
+// evictLocked evicts items chosen by eviction policy while the cache is over its limits
+// and the shard is over its share of them, the new key is left for TypedCache.fit to decide,
+// evicted items are appended to evicted, s.mu must be held
+func (s *shard[K, V]) evictLocked(evicted []evictedEntry[K, V], newKey K) []evictedEntry[K, V] {
+	now := nanotime()
+
+	for s.budget.over() && s.overShare() {
+		key, ok := s.policy.Victim()
+		if !ok || key == newKey {
+			break
+		}
+
+		evicted = s.evictKeyLocked(evicted, key, now)
+	}
+
+	return evicted
+}
+
+// evictKeyLocked evicts the item of the key to fit the cache limits, s.mu must be held
+func (s *shard[K, V]) evictKeyLocked(evicted []evictedEntry[K, V], key K, now int64) []evictedEntry[K, V] {
+	item := s.data[key]
+	s.removeLocked(key, item)
+	s.stats.evictions.Add(1)
+
+	return s.evictedLocked(evicted, key, item, EvictCapacity, now)
+}
+
+// expire removes items whose timers are due, at most limit of them,
+// it reports whether all due items are removed
+func (s *shard[K, V]) expire(limit int) ([]evictedEntry[K, V], bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.wheel == nil {
+		return nil, true
+	}
+
+	now := nanotime()
+	var evicted []evictedEntry[K, V]
+
+	done := s.wheel.advance(now, limit, func(key K) {
+		item := s.data[key]
+		s.removeLocked(key, item)
+		evicted = s.evictedLocked(evicted, key, item, EvictExpired, now)
+	})
+
+	return evicted, done
+}
+
+// ttl returns the remaining time to live of the item
+func (s *shard[K, V]) ttl(key K) (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := nanotime()
+
+	item, ok := s.data[key]
+	if !ok || item.expired(now) {
+		return 0, false
+	}
+
+	return item.ttl(now), true
+}
+
+// snapshot copies items which are not expired with their remaining ttl
+func (s *shard[K, V]) snapshot(now int64) []snapshotEntry[K, V] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]snapshotEntry[K, V], 0, len(s.data))
+	for key, item := range s.data {
+		if item.expired(now) {
+			continue
+		}
+
+		ttl := item.ttl(now)
+		if item.expiresAt != 0 && ttl <= 0 {
+			continue
+		}
+
+		entries = append(entries, snapshotEntry[K, V]{key: key, value: item.value, ttl: ttl})
+	}
+
+	return entries
+}
@@ -0,0 +1,114 @@
+package cache
+
+const (
+	skipListMaxLevel = 24
+	// skipListBranching - a node is promoted to the next level with probability 1/skipListBranching
+	skipListBranching = 4
+)
+
+// skipList keeps keys of a shard ordered, it is guarded by the shard lock
+type skipList struct {
+	head  skipNode
+	level int
+	len   int
+	// rnd is xorshift state for node levels
+	rnd uint64
+}
+
+type skipNode struct {
+	key  string
+	next []*skipNode
+}
+
+func newSkipList() *skipList {
+	l := &skipList{rnd: 0x9e3779b97f4a7c15}
+	l.reset()
+
+	return l
+}
+
+func (l *skipList) reset() {
+	l.head.next = make([]*skipNode, skipListMaxLevel)
+	l.level = 1
+	l.len = 0
+}
+
+func (l *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel {
+		l.rnd ^= l.rnd << 13
+		l.rnd ^= l.rnd >> 7
+		l.rnd ^= l.rnd << 17
+		if l.rnd%skipListBranching != 0 {
+			break
+		}
+		level++
+	}
+
+	return level
+}
+
+// path finds the last node before key on every level
+func (l *skipList) path(key string, update *[skipListMaxLevel]*skipNode) {
+	x := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+}
+
+func (l *skipList) insert(key string) {
+	var update [skipListMaxLevel]*skipNode
+	l.path(key, &update)
+
+	if next := update[0].next[0]; next != nil && next.key == key {
+		return
+	}
+
+	level := l.randomLevel()
+	for i := l.level; i < level; i++ {
+		update[i] = &l.head
+	}
+	if level > l.level {
+		l.level = level
+	}
+
+	n := &skipNode{key: key, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = update[i].next[i]
+		update[i].next[i] = n
+	}
+	l.len++
+}
+
+func (l *skipList) remove(key string) {
+	var update [skipListMaxLevel]*skipNode
+	l.path(key, &update)
+
+	n := update[0].next[0]
+	if n == nil || n.key != key {
+		return
+	}
+
+	for i := 0; i < len(n.next); i++ {
+		update[i].next[i] = n.next[i]
+	}
+	for l.level > 1 && l.head.next[l.level-1] == nil {
+		l.level--
+	}
+	l.len--
+}
+
+// seek returns the first node with key not less than the given one
+func (l *skipList) seek(key string) *skipNode {
+	x := &l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+	}
+
+	return x.next[0]
+}
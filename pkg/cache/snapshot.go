@@ -0,0 +1,334 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Snapshot file layout, integers are big endian:
+//
+//	magic "SCSN" | version uint16 | records | 0x00 | count uint64 | crc32 uint32
+//
+// every record is 0x01 | key length uvarint | key | value length uvarint | value |
+// expire time in unix nanoseconds varint, 0 - no expire time.
+// The expire time is absolute like in the append-only log, so the time the cache was down
+// counts against the ttl. The checksum is CRC-32C of everything before it
+const (
+	snapshotMagic   = "SCSN"
+	snapshotVersion = 1
+
+	snapshotRecord = 1
+	snapshotEnd    = 0
+
+	// snapshotMaxString protects from allocating memory for a damaged length
+	snapshotMaxString = 1 << 30
+)
+
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotEntry[K comparable, V any] struct {
+	key   K
+	value V
+	ttl   time.Duration
+}
+
+// Snapshot writes all items to the snapshot file, the file is written to a temp file
+// which is renamed into place, so a failed snapshot doesn't damage the previous one
+func (c *Cache) Snapshot() error {
+	if c.snapshotFile == "" {
+		return ErrSnapshotDisabled
+	}
+
+	c.snapshotMu.Lock()
+	defer c.snapshotMu.Unlock()
+
+	if err := writeFileAtomic(c.snapshotFile, c.WriteSnapshot); err != nil {
+		return errors.Wrap(ErrSnapshotWrite, err.Error())
+	}
+
+	return nil
+}
+
+// LoadSnapshot reads items from the snapshot file, expired items are skipped,
+// a missing file is not an error
+func (c *Cache) LoadSnapshot() error {
+	if c.snapshotFile == "" {
+		return ErrSnapshotDisabled
+	}
+
+	f, err := os.Open(c.snapshotFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(ErrSnapshotRead, err.Error())
+	}
+	defer f.Close()
+
+	return c.ReadSnapshot(f)
+}
+
+// WriteSnapshot writes all items to w. Shards are copied one by one under the read lock,
+// so writers are blocked only while their shard is copied, and every shard is consistent
+// at its own point in time
+func (c *Cache) WriteSnapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.New(snapshotTable)
+	out := io.MultiWriter(bw, crc)
+
+	header := make([]byte, len(snapshotMagic)+2)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic):], snapshotVersion)
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	var count uint64
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	for _, s := range c.shards {
+		for _, e := range s.snapshot(nanotime()) {
+			if _, err := out.Write([]byte{snapshotRecord}); err != nil {
+				return err
+			}
+			if err := writeSnapshotString(out, buf, e.key); err != nil {
+				return err
+			}
+			if err := writeSnapshotString(out, buf, e.value); err != nil {
+				return err
+			}
+
+			var expiresAt int64
+			if e.ttl > 0 {
+				expiresAt = time.Now().Add(e.ttl).UnixNano()
+			}
+			if _, err := out.Write(buf[:binary.PutVarint(buf, expiresAt)]); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+
+	trailer := make([]byte, 1+8)
+	trailer[0] = snapshotEnd
+	binary.BigEndian.PutUint64(trailer[1:], count)
+	if _, err := out.Write(trailer); err != nil {
+		return err
+	}
+
+	if err := binary.Write(bw, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ReadSnapshot loads items written by WriteSnapshot, items are added only
+// when the whole snapshot is read and its checksum matches, items which
+// expired since the snapshot was written are skipped
+func (c *Cache) ReadSnapshot(r io.Reader) error {
+	entries, err := readSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.ttl < 0 {
+			continue
+		}
+		c.fit(e.key, c.shard(e.key).set(e.key, e.value, e.ttl))
+	}
+
+	return nil
+}
+
+func readSnapshot(r io.Reader) ([]snapshotEntry[string, string], error) {
+	cr := &crcReader{r: bufio.NewReader(r), crc: crc32.New(snapshotTable)}
+
+	header := make([]byte, len(snapshotMagic)+2)
+	if _, err := io.ReadFull(cr, header); err != nil {
+		return nil, errors.Wrap(ErrSnapshotRead, err.Error())
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, ErrSnapshotFormat
+	}
+	if version := binary.BigEndian.Uint16(header[len(snapshotMagic):]); version != snapshotVersion {
+		return nil, errors.Wrap(ErrSnapshotVersion, "version "+strconv.Itoa(int(version)))
+	}
+
+	var entries []snapshotEntry[string, string]
+
+	for {
+		kind, err := cr.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(ErrSnapshotRead, err.Error())
+		}
+		if kind == snapshotEnd {
+			break
+		}
+		if kind != snapshotRecord {
+			return nil, ErrSnapshotFormat
+		}
+
+		var e snapshotEntry[string, string]
+		if e.key, err = readSnapshotString(cr); err != nil {
+			return nil, err
+		}
+		if e.value, err = readSnapshotString(cr); err != nil {
+			return nil, err
+		}
+
+		expire, err := binary.ReadVarint(cr)
+		if err != nil {
+			return nil, errors.Wrap(ErrSnapshotRead, err.Error())
+		}
+		e.ttl = snapshotTTL(expire)
+
+		entries = append(entries, e)
+	}
+
+	var count uint64
+	if err := binary.Read(cr, binary.BigEndian, &count); err != nil {
+		return nil, errors.Wrap(ErrSnapshotRead, err.Error())
+	}
+	if count != uint64(len(entries)) {
+		return nil, ErrSnapshotFormat
+	}
+
+	sum := cr.crc.Sum32()
+
+	var want uint32
+	if err := binary.Read(cr.r, binary.BigEndian, &want); err != nil {
+		return nil, errors.Wrap(ErrSnapshotRead, err.Error())
+	}
+	if sum != want {
+		return nil, ErrSnapshotChecksum
+	}
+
+	return entries, nil
+}
+
+// snapshotTTL returns the remaining ttl of the record, 0 means no expire time
+// and a negative ttl means the item is expired
+func snapshotTTL(expire int64) time.Duration {
+	if expire == 0 {
+		return 0
+	}
+
+	if ttl := time.Until(time.Unix(0, expire)); ttl > 0 {
+		return ttl
+	}
+
+	return -1
+}
+
+func writeSnapshotString(w io.Writer, buf []byte, s string) error {
+	if _, err := w.Write(buf[:binary.PutUvarint(buf, uint64(len(s)))]); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, s)
+
+	return err
+}
+
+func readSnapshotString(r *crcReader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", errors.Wrap(ErrSnapshotRead, err.Error())
+	}
+	if n > snapshotMaxString {
+		return "", ErrSnapshotFormat
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", errors.Wrap(ErrSnapshotRead, err.Error())
+	}
+
+	return string(b), nil
+}
+
+// crcReader computes checksum of everything read through it
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+
+	return n, err
+}
+
+func (cr *crcReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+	}
+
+	return b, err
+}
+
+// writeFileAtomic writes file with write to a temp file in the same directory,
+// syncs it and renames it into place
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// the rename is durable only when the directory is synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// snapshotter periodically writes snapshots
+func (c *Cache) snapshotter() {
+	ticker := time.NewTicker(c.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if err := c.Snapshot(); err != nil && c.snapshotErrorHandler != nil {
+				c.snapshotErrorHandler(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	const items = 100
+
+	cache := New()
+
+	for i := 0; i < items; i++ {
+		cache.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("val%d", i), 0)
+	}
+	cache.Set("ttl", "val", time.Hour)
+	cache.Set("expired", "val", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := cache.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("cache.WriteSnapshot() = %v, want %v", err, nil)
+	}
+
+	restored := New()
+	if err := restored.ReadSnapshot(&buf); err != nil {
+		t.Fatalf("restored.ReadSnapshot() = %v, want %v", err, nil)
+	}
+
+	for i := 0; i < items; i++ {
+		key, want := fmt.Sprintf("key%d", i), fmt.Sprintf("val%d", i)
+		if gotVal, gotOk := restored.Get(key); gotVal != want || gotOk != true {
+			t.Errorf("restored.Get(%q) = %q, %t, want %q, %t", key, gotVal, gotOk, want, true)
+		}
+	}
+	if _, gotOk := restored.Get("expired"); gotOk != false {
+		t.Errorf("restored.Get(%q) = %t, want %t", "expired", gotOk, false)
+	}
+
+	if ttl, ok := restored.TTL("ttl"); ttl <= 0 || ttl > time.Hour || !ok {
+		t.Errorf("restored.TTL(%q) = %v, %t, want in (0, %v], %t", "ttl", ttl, ok, time.Hour, true)
+	}
+}
+
+func TestSnapshotDowntime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	cache := New(WithSnapshotFile(path))
+	cache.Set("short", "val", 50*time.Millisecond)
+	cache.Set("long", "val", time.Hour)
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("cache.Snapshot() = %v, want %v", err, nil)
+	}
+	cache.Close()
+
+	// the cache is down longer than the short ttl
+	time.Sleep(100 * time.Millisecond)
+
+	restored := New(WithSnapshotFile(path))
+	defer restored.Close()
+	if err := restored.LoadSnapshot(); err != nil {
+		t.Fatalf("restored.LoadSnapshot() = %v, want %v", err, nil)
+	}
+
+	if _, gotOk := restored.Get("short"); gotOk != false {
+		t.Errorf("restored.Get(%q) = %t, want %t", "short", gotOk, false)
+	}
+	if ttl, ok := restored.TTL("long"); ttl <= 0 || ttl > time.Hour-100*time.Millisecond || !ok {
+		t.Errorf("restored.TTL(%q) = %v, %t, want in (0, %v], %t", "long", ttl, ok, time.Hour-100*time.Millisecond, true)
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	cache := New()
+	cache.Set("key", "val", 0)
+
+	var buf bytes.Buffer
+	if err := cache.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("cache.WriteSnapshot() = %v, want %v", err, nil)
+	}
+
+	data := buf.Bytes()
+	data[bytes.Index(data, []byte("val"))] = 'x'
+
+	restored := New()
+	if err := restored.ReadSnapshot(bytes.NewReader(data)); err != ErrSnapshotChecksum {
+		t.Errorf("restored.ReadSnapshot() = %v, want %v", err, ErrSnapshotChecksum)
+	}
+	if _, gotOk := restored.Get("key"); gotOk != false {
+		t.Errorf("restored.Get(%q) = %t, want %t", "key", gotOk, false)
+	}
+
+	if err := restored.ReadSnapshot(bytes.NewReader(data[:len(data)/2])); !errors.Is(err, ErrSnapshotRead) {
+		t.Errorf("restored.ReadSnapshot() of truncated snapshot = %v, want %v", err, ErrSnapshotRead)
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	cache := New(WithSnapshotFile(path))
+	if err := cache.LoadSnapshot(); err != nil {
+		t.Fatalf("cache.LoadSnapshot() of missing file = %v, want %v", err, nil)
+	}
+
+	cache.Set("key", "val", 0)
+	if err := cache.Snapshot(); err != nil {
+		t.Fatalf("cache.Snapshot() = %v, want %v", err, nil)
+	}
+
+	restored := New(WithSnapshotFile(path))
+	if err := restored.LoadSnapshot(); err != nil {
+		t.Fatalf("restored.LoadSnapshot() = %v, want %v", err, nil)
+	}
+	if gotVal, gotOk := restored.Get("key"); gotVal != "val" || gotOk != true {
+		t.Errorf("restored.Get(%q) = %q, %t, want %q, %t", "key", gotVal, gotOk, "val", true)
+	}
+
+	if files, _ := filepath.Glob(path + ".tmp-*"); len(files) != 0 {
+		t.Errorf("temp files left: %v", files)
+	}
+
+	if err := New().Snapshot(); err != ErrSnapshotDisabled {
+		t.Errorf("New().Snapshot() = %v, want %v", err, ErrSnapshotDisabled)
+	}
+}
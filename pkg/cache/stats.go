@@ -0,0 +1,64 @@
+package cache
+
+import "sync/atomic"
+
+// Stats is a snapshot of the cache state and counters since the cache creation
+type Stats struct {
+	Hits uint64
+	// Misses includes reads of expired items
+	Misses uint64
+	// ExpiredOnRead is the number of reads which found an expired item not removed yet
+	ExpiredOnRead uint64
+	// Evictions is the number of items evicted to fit the cache limits
+	Evictions uint64
+	// Sets and Deletes are the numbers of Set and Delete calls
+	// and of items set and deleted by atomic operations
+	Sets    uint64
+	Deletes uint64
+
+	// Entries includes expired items not removed yet
+	Entries int
+	// Bytes is approximate memory used by items, it is measured like for WithMaxBytes
+	Bytes int64
+}
+
+// HitRatio is the share of reads which found an item, 0 when there were no reads
+func (s Stats) HitRatio() float64 {
+	reads := s.Hits + s.Misses
+	if reads == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(reads)
+}
+
+// shardStats are counters of a shard, they are updated without the shard lock
+type shardStats struct {
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	expiredOnRead atomic.Uint64
+	evictions     atomic.Uint64
+	sets          atomic.Uint64
+	deletes       atomic.Uint64
+}
+
+// Stats returns cache statistics, shards are read one by one,
+// so the counters of different shards are not taken at the same moment
+func (c *TypedCache[K, V]) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		stats.Hits += s.stats.hits.Load()
+		stats.Misses += s.stats.misses.Load()
+		stats.ExpiredOnRead += s.stats.expiredOnRead.Load()
+		stats.Evictions += s.stats.evictions.Load()
+		stats.Sets += s.stats.sets.Load()
+		stats.Deletes += s.stats.deletes.Load()
+
+		s.mu.RLock()
+		stats.Entries += len(s.data)
+		stats.Bytes += s.bytes
+		s.mu.RUnlock()
+	}
+
+	return stats
+}
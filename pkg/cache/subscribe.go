@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultSubscriptionBuffer = 1024
+
+type EventType int
+
+const (
+	// EventSet - the key is set to Value
+	EventSet EventType = iota
+	// EventDelete - the key is deleted by Delete or Flush
+	EventDelete
+	// EventExpire - ttl of the key has expired
+	EventExpire
+	// EventEvict - the key is evicted by eviction policy to fit the cache limits
+	EventEvict
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	case EventEvict:
+		return "evict"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change of a key, events of one key come in the order the changes were applied in
+type Event struct {
+	Type EventType
+	Key  string
+	// Value is the new value for set events and the removed value for others
+	Value string
+	Time  time.Time
+	// Dropped is how many events of the subscription were dropped right before this one
+	// because its buffer was full, state derived from the keys should be rebuilt when it's not 0
+	Dropped uint64
+}
+
+type SlowSubscriberPolicy int
+
+const (
+	// SlowSubscriberDrop drops events which don't fit the subscription buffer,
+	// the next delivered event tells how many were dropped
+	SlowSubscriberDrop SlowSubscriberPolicy = iota
+	// SlowSubscriberDisconnect closes the subscription channel when the buffer is full
+	SlowSubscriberDisconnect
+)
+
+// hub delivers changes of the cache to subscriptions, it is the change observer of all shards,
+// so events are sent under the shard lock and sending never blocks
+type hub struct {
+	bufferSize int
+	policy     SlowSubscriberPolicy
+
+	mu     sync.RWMutex
+	subs   map[*subscription]struct{}
+	closed bool
+	// count is the number of subscriptions, shards don't report changes when it's 0
+	count atomic.Int32
+}
+
+type subscription struct {
+	prefix string
+
+	mu      sync.Mutex
+	ch      chan Event
+	closed  bool
+	dropped uint64
+}
+
+func newHub(bufferSize int, policy SlowSubscriberPolicy) *hub {
+	return &hub{
+		bufferSize: bufferSize,
+		policy:     policy,
+		subs:       make(map[*subscription]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events of keys with the prefix, the empty prefix matches all keys.
+// The channel is buffered, when a slow subscriber lets the buffer fill up, events are dropped
+// or the channel is closed as WithSlowSubscriberPolicy sets. Cancel closes the channel and
+// must be called when the subscription is not needed anymore, even if the channel is closed
+func (c *Cache) Subscribe(prefix string) (<-chan Event, func()) {
+	return c.hub.subscribe(prefix)
+}
+
+func (h *hub) subscribe(prefix string) (<-chan Event, func()) {
+	sub := &subscription{prefix: prefix, ch: make(chan Event, h.bufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+
+	h.subs[sub] = struct{}{}
+	h.count.Add(1)
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if _, ok := h.subs[sub]; ok {
+				delete(h.subs, sub)
+				h.count.Add(-1)
+			}
+			sub.close()
+		})
+	}
+
+	return sub.ch, cancel
+}
+
+// close closes all subscriptions
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		sub.close()
+		delete(h.subs, sub)
+	}
+	h.count.Store(0)
+}
+
+func (h *hub) active() bool {
+	return h.count.Load() > 0
+}
+
+func (h *hub) set(key, value string) {
+	h.publish(Event{Type: EventSet, Key: key, Value: value})
+}
+
+// removed publishes removal of the key, a replaced value is not published as the set follows it
+func (h *hub) removed(key, value string, reason EvictReason) {
+	var typ EventType
+
+	switch reason {
+	case EvictReplaced:
+		return
+	case EvictDeleted:
+		typ = EventDelete
+	case EvictExpired:
+		typ = EventExpire
+	case EvictCapacity:
+		typ = EventEvict
+	}
+
+	h.publish(Event{Type: typ, Key: key, Value: value})
+}
+
+func (h *hub) publish(e Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	e.Time = time.Now()
+
+	for sub := range h.subs {
+		if strings.HasPrefix(e.Key, sub.prefix) {
+			sub.send(e, h.policy)
+		}
+	}
+}
+
+func (s *subscription) send(e Event, policy SlowSubscriberPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	e.Dropped = s.dropped
+
+	select {
+	case s.ch <- e:
+		s.dropped = 0
+	default:
+		if policy == SlowSubscriberDisconnect {
+			s.closed = true
+			close(s.ch)
+			return
+		}
+		s.dropped++
+	}
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("no event received")
+		return Event{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	cache := New(WithMaxEntries(2), WithShards(1), WithJanitorInterval(10*time.Millisecond))
+	defer cache.Close()
+
+	events, cancel := cache.Subscribe("user:")
+	defer cancel()
+
+	cache.Set("user:1", "val1", 0)
+	cache.Set("other", "val", 0)
+	cache.Set("user:1", "new1", 0)
+	cache.Delete("user:1")
+	cache.Set("user:2", "val2", time.Millisecond)
+
+	want := []Event{
+		{Type: EventSet, Key: "user:1", Value: "val1"},
+		{Type: EventSet, Key: "user:1", Value: "new1"},
+		{Type: EventDelete, Key: "user:1", Value: "new1"},
+		{Type: EventSet, Key: "user:2", Value: "val2"},
+		{Type: EventExpire, Key: "user:2", Value: "val2"},
+	}
+	for _, w := range want {
+		got := receive(t, events)
+		if got.Time.IsZero() {
+			t.Errorf("event time is zero")
+		}
+		got.Time = time.Time{}
+
+		if got != w {
+			t.Errorf("event = %+v, want %+v", got, w)
+		}
+	}
+
+	cache.Set("user:3", "val3", 0)
+	cache.Set("user:4", "val4", 0)
+	receive(t, events)
+	receive(t, events)
+	cache.Set("user:5", "val5", 0)
+
+	// "other" is evicted by user:4 and not seen by the subscription
+	if got := receive(t, events); got.Type != EventSet || got.Key != "user:5" {
+		t.Errorf("event = %v %q, want %v %q", got.Type, got.Key, EventSet, "user:5")
+	}
+	if got := receive(t, events); got.Type != EventEvict || got.Key != "user:3" {
+		t.Errorf("event = %v %q, want %v %q", got.Type, got.Key, EventEvict, "user:3")
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("subscription channel is not closed by cancel")
+	}
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	cache := New(WithSubscriptionBuffer(2))
+
+	events, cancel := cache.Subscribe("")
+	defer cancel()
+
+	for _, key := range []string{"key1", "key2", "key3", "key4"} {
+		cache.Set(key, "val", 0)
+	}
+	receive(t, events)
+	receive(t, events)
+	cache.Set("key5", "val", 0)
+
+	if got := receive(t, events); got.Key != "key5" || got.Dropped != 2 {
+		t.Errorf("event = %q dropped %d, want %q dropped %d", got.Key, got.Dropped, "key5", 2)
+	}
+
+	cache.Close()
+	if _, ok := <-events; ok {
+		t.Errorf("subscription channel is not closed by cache.Close")
+	}
+
+	disconnecting := New(WithSubscriptionBuffer(1), WithSlowSubscriberPolicy(SlowSubscriberDisconnect))
+	defer disconnecting.Close()
+
+	events, cancel = disconnecting.Subscribe("")
+	defer cancel()
+
+	disconnecting.Set("key1", "val", 0)
+	disconnecting.Set("key2", "val", 0)
+
+	if got := receive(t, events); got.Key != "key1" {
+		t.Errorf("event key = %q, want %q", got.Key, "key1")
+	}
+	if _, ok := <-events; ok {
+		t.Errorf("subscription channel of slow subscriber is not closed")
+	}
+}
+
+func TestSubscribeOversized(t *testing.T) {
+	cache := New(WithMaxBytes(1000))
+
+	events, cancel := cache.Subscribe("")
+	defer cancel()
+
+	cache.Set("key", "val", 0)
+	cache.Set("key", strings.Repeat("v", 1000), 0)
+	cache.Set("other", "val", 0)
+
+	// the oversized value is never set, the value it has overwritten is evicted
+	want := []Event{
+		{Type: EventSet, Key: "key", Value: "val"},
+		{Type: EventEvict, Key: "key", Value: "val"},
+		{Type: EventSet, Key: "other", Value: "val"},
+	}
+	for _, w := range want {
+		got := receive(t, events)
+		got.Time = time.Time{}
+
+		if got != w {
+			t.Errorf("event = %+v, want %+v", got, w)
+		}
+	}
+}
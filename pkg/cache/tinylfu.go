@@ -0,0 +1,269 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+const (
+	sketchDepth      = 4
+	sketchMaxCount   = 15
+	sketchMinWidth   = 1024
+	sketchResetRatio = 10
+	// tinyLFUWindowPercent is the admission window share of all keys
+	tinyLFUWindowPercent = 1
+	// tinyLFUProtectedPercent is the protected segment share of the main space
+	tinyLFUProtectedPercent = 80
+)
+
+const (
+	segmentWindow = iota
+	segmentProbation
+	segmentProtected
+)
+
+// countMinSketch estimates key frequencies with 4-bit-like saturating counters,
+// all counters are halved after sample size increments so old popularity fades away
+type countMinSketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint32
+	additions  int
+	sampleSize int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := sketchMinWidth
+	for width < capacity {
+		width <<= 1
+	}
+
+	s := &countMinSketch{
+		mask:       uint32(width - 1),
+		sampleSize: sketchResetRatio * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+
+	return s
+}
+
+func (s *countMinSketch) indexes(sum uint64) [sketchDepth]uint32 {
+	h1, h2 := uint32(sum), uint32(sum>>32)
+
+	var idx [sketchDepth]uint32
+	for i := range idx {
+		idx[i] = (h1 + uint32(i)*h2) & s.mask
+	}
+
+	return idx
+}
+
+func (s *countMinSketch) increment(sum uint64) {
+	for i, j := range s.indexes(sum) {
+		if s.rows[i][j] < sketchMaxCount {
+			s.rows[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(sum uint64) uint8 {
+	min := uint8(sketchMaxCount)
+	for i, j := range s.indexes(sum) {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+
+	return min
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// tinyLFU is W-TinyLFU policy: new keys enter a small LRU window, keys leaving the window
+// are admitted to the main segmented LRU only when they are used more often than
+// the main victim according to the frequency sketch, so one-off scans can't flush popular keys
+type tinyLFU[K comparable] struct {
+	capacity int
+	hash     func(K) uint64
+	sketch   *countMinSketch
+	entries  map[K]*tinyLFUEntry[K]
+	window   *list.List
+	// probation and protected are segments of the main space,
+	// keys hit in probation are promoted to protected
+	probation *list.List
+	protected *list.List
+}
+
+type tinyLFUEntry[K comparable] struct {
+	key     K
+	segment int
+	elem    *list.Element
+}
+
+func NewTinyLFUPolicy(capacity int) Policy {
+	return NewTinyLFUKeyPolicy[string](capacity)
+}
+
+// NewTinyLFUKeyPolicy is NewTinyLFUPolicy for keys of any type,
+// keys are hashed for the frequency sketch like cache keys are hashed for shards
+func NewTinyLFUKeyPolicy[K comparable](capacity int) KeyPolicy[K] {
+	return &tinyLFU[K]{
+		capacity:  capacity,
+		hash:      newKeyHash[K](maphash.MakeSeed()),
+		sketch:    newCountMinSketch(capacity),
+		entries:   make(map[K]*tinyLFUEntry[K]),
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+	}
+}
+
+func (t *tinyLFU[K]) Add(key K) {
+	if _, ok := t.entries[key]; ok {
+		t.Access(key)
+		return
+	}
+
+	t.sketch.increment(t.hash(key))
+
+	e := &tinyLFUEntry[K]{key: key, segment: segmentWindow}
+	e.elem = t.window.PushFront(e)
+	t.entries[key] = e
+
+	// while the main space has room keys leaving the window are admitted without competition
+	windowCap := t.windowCap()
+	for t.window.Len() > windowCap && t.mainHasRoom(windowCap) {
+		t.move(t.window.Back().Value.(*tinyLFUEntry[K]), segmentProbation)
+	}
+}
+
+func (t *tinyLFU[K]) Access(key K) {
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+
+	t.sketch.increment(t.hash(key))
+
+	switch e.segment {
+	case segmentWindow:
+		t.window.MoveToFront(e.elem)
+	case segmentProbation:
+		t.move(e, segmentProtected)
+		t.demoteProtected()
+	case segmentProtected:
+		t.protected.MoveToFront(e.elem)
+	}
+}
+
+func (t *tinyLFU[K]) Remove(key K) {
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+
+	t.list(e.segment).Remove(e.elem)
+	delete(t.entries, key)
+}
+
+// Victim lets the oldest window key and the main victim compete by frequency
+// when the window is full, the loser is evicted and the winning window key is admitted to main
+func (t *tinyLFU[K]) Victim() (K, bool) {
+	if len(t.entries) == 0 {
+		var zero K
+		return zero, false
+	}
+
+	victim, ok := t.mainVictim()
+	if !ok {
+		return t.window.Back().Value.(*tinyLFUEntry[K]).key, true
+	}
+
+	if t.window.Len() == 0 || t.window.Len() < t.windowCap() {
+		return victim.key, true
+	}
+
+	candidate := t.window.Back().Value.(*tinyLFUEntry[K])
+	if t.sketch.estimate(t.hash(candidate.key)) > t.sketch.estimate(t.hash(victim.key)) {
+		t.move(candidate, segmentProbation)
+		return victim.key, true
+	}
+
+	return candidate.key, true
+}
+
+// windowCap is the window share of the capacity,
+// of all keys when the capacity is unknown
+func (t *tinyLFU[K]) windowCap() int {
+	total := t.capacity
+	if total <= 0 {
+		total = len(t.entries)
+	}
+
+	windowCap := total * tinyLFUWindowPercent / 100
+	if windowCap < 1 {
+		windowCap = 1
+	}
+
+	return windowCap
+}
+
+func (t *tinyLFU[K]) mainHasRoom(windowCap int) bool {
+	if t.capacity <= 0 {
+		return true
+	}
+
+	return t.probation.Len()+t.protected.Len() < t.capacity-windowCap
+}
+
+func (t *tinyLFU[K]) mainVictim() (*tinyLFUEntry[K], bool) {
+	if elem := t.probation.Back(); elem != nil {
+		return elem.Value.(*tinyLFUEntry[K]), true
+	}
+	if elem := t.protected.Back(); elem != nil {
+		return elem.Value.(*tinyLFUEntry[K]), true
+	}
+
+	return nil, false
+}
+
+// demoteProtected moves the least recently used protected keys
+// back to probation when protected segment is over its share
+func (t *tinyLFU[K]) demoteProtected() {
+	mainLen := t.probation.Len() + t.protected.Len()
+	protectedCap := mainLen * tinyLFUProtectedPercent / 100
+
+	for t.protected.Len() > protectedCap && t.protected.Len() > 0 {
+		t.move(t.protected.Back().Value.(*tinyLFUEntry[K]), segmentProbation)
+	}
+}
+
+func (t *tinyLFU[K]) move(e *tinyLFUEntry[K], segment int) {
+	t.list(e.segment).Remove(e.elem)
+	e.segment = segment
+	e.elem = t.list(segment).PushFront(e)
+}
+
+func (t *tinyLFU[K]) list(segment int) *list.List {
+	switch segment {
+	case segmentProbation:
+		return t.probation
+	case segmentProtected:
+		return t.protected
+	default:
+		return t.window
+	}
+}
@@ -0,0 +1,324 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultJanitorBatchSize = 256
+	// entryOverhead is an estimate of memory used by an entry besides its key and value:
+	// map bucket slot, item struct, string headers and lru list element
+	entryOverhead = 128
+	// shardsPerProc is how many shards are created per GOMAXPROCS by default
+	shardsPerProc = 4
+)
+
+type item[K comparable, V any] struct {
+	value V
+	// expiresAt is nanotime of expiration, 0 - no expire time
+	expiresAt int64
+	// timer is nil when the item has no ttl or the janitor is off
+	timer *timerNode[K]
+}
+
+func (i item[K, V]) expired(now int64) bool {
+	return i.expiresAt != 0 && now > i.expiresAt
+}
+
+// ttl returns the remaining time to live, 0 - no expire time
+func (i item[K, V]) ttl(now int64) time.Duration {
+	if i.expiresAt == 0 {
+		return 0
+	}
+
+	return time.Duration(i.expiresAt - now)
+}
+
+// TypedCache is in-memory storage of values of any type split into shards by key hash,
+// limits are of the whole cache, every shard evicts its own items down to its even share
+// of them first and the shards which are the most over their shares are evicted from then
+type TypedCache[K comparable, V any] struct {
+	shards []*shard[K, V]
+	mask   uint64
+	hash   func(K) uint64
+	// budget is nil when the cache is not bounded
+	budget *budget
+
+	janitorInterval  time.Duration
+	janitorBatchSize int
+	janitorBudget    time.Duration
+	// janitorShard is the shard the next janitor run starts from,
+	// so shards at the end are not starved when the budget runs out
+	janitorShard int
+
+	// log is nil unless Cache has opened its append-only log
+	log     changeLog[K, V]
+	onEvict atomic.Pointer[EvictFunc[K, V]]
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewTyped creates a cache of values of type V by keys of type K,
+// eviction policy, snapshot and append-only log options shared with Cache are ignored
+func NewTyped[K comparable, V any](opts ...TypedOption[K, V]) *TypedCache[K, V] {
+	o := typedOptions[K, V]{options: getDefaultOptions()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return newTypedCache[K, V](o)
+}
+
+func newTypedCache[K comparable, V any](o typedOptions[K, V]) *TypedCache[K, V] {
+	c := &TypedCache[K, V]{
+		janitorInterval:  o.janitorInterval,
+		janitorBatchSize: o.janitorBatchSize,
+		janitorBudget:    o.janitorBudget,
+		done:             make(chan struct{}),
+	}
+
+	newPolicy := NewLRUKeyPolicy[K]
+	if o.newPolicy != nil {
+		newPolicy = o.newPolicy
+	}
+
+	size := defaultSize[K, V]
+	if o.sizeFunc != nil {
+		size = o.sizeFunc
+	}
+
+	c.hash = newKeyHash[K](maphash.MakeSeed())
+	if o.keyHash != nil {
+		c.hash = o.keyHash
+	}
+
+	n := 1
+	for n < o.shardsNum {
+		n <<= 1
+	}
+	c.mask = uint64(n - 1)
+
+	c.budget = newBudget(o.maxEntries, o.maxBytes)
+
+	c.shards = make([]*shard[K, V], n)
+	for i := range c.shards {
+		c.shards[i] = newShard[K, V](ceilDiv(o.maxEntries, n), int64(ceilDiv(int(o.maxBytes), n)), c.budget, newPolicy, size, o.janitorInterval, &c.onEvict)
+	}
+
+	if c.janitorBudget <= 0 {
+		c.janitorBudget = c.janitorInterval / 4
+	}
+
+	if c.janitorInterval > 0 {
+		go c.janitor()
+	}
+
+	return c
+}
+
+// newKeyHash returns hash function of keys, strings and integers are hashed directly,
+// other keys by their fmt representation
+func newKeyHash[K comparable](seed maphash.Seed) func(K) uint64 {
+	return func(key K) uint64 {
+		switch k := any(&key).(type) {
+		case *string:
+			return maphash.String(seed, *k)
+		case *int:
+			return hashUint(seed, uint64(*k))
+		case *int8:
+			return hashUint(seed, uint64(*k))
+		case *int16:
+			return hashUint(seed, uint64(*k))
+		case *int32:
+			return hashUint(seed, uint64(*k))
+		case *int64:
+			return hashUint(seed, uint64(*k))
+		case *uint:
+			return hashUint(seed, uint64(*k))
+		case *uint8:
+			return hashUint(seed, uint64(*k))
+		case *uint16:
+			return hashUint(seed, uint64(*k))
+		case *uint32:
+			return hashUint(seed, uint64(*k))
+		case *uint64:
+			return hashUint(seed, *k)
+		case *uintptr:
+			return hashUint(seed, uint64(*k))
+		default:
+			return maphash.String(seed, fmt.Sprint(key))
+		}
+	}
+}
+
+func hashUint(seed maphash.Seed, v uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+
+	return maphash.Bytes(seed, b[:])
+}
+
+// defaultSize measures strings and byte slices, other keys and values count as 0
+func defaultSize[K comparable, V any](key K, value V) int64 {
+	return valueSize(&key) + valueSize(&value)
+}
+
+func valueSize(v any) int64 {
+	switch v := v.(type) {
+	case *string:
+		return int64(len(*v))
+	case *[]byte:
+		return int64(len(*v))
+	default:
+		return 0
+	}
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+func (c *TypedCache[K, V]) shard(key K) *shard[K, V] {
+	return c.shards[c.hash(key)&c.mask]
+}
+
+func (c *TypedCache[K, V]) Get(key K) (V, bool) {
+	return c.shard(key).get(key)
+}
+
+// Set sets key-value pair
+// ttl - expiration time, if 0 - no expire time.
+// When the cache is bounded, items chosen by eviction policy are evicted to fit the new one,
+// an item bigger than max bytes of the cache is not stored
+func (c *TypedCache[K, V]) Set(key K, value V, ttl time.Duration) {
+	s := c.shard(key)
+	s.stats.sets.Add(1)
+
+	c.notify(c.fit(key, s.set(key, value, ttl)))
+}
+
+// TTL returns the remaining time to live of the item, 0 - no expire time,
+// false when there is no such item or it's expired. It isn't counted as a read
+func (c *TypedCache[K, V]) TTL(key K) (time.Duration, bool) {
+	return c.shard(key).ttl(key)
+}
+
+func (c *TypedCache[K, V]) Delete(key K) {
+	s := c.shard(key)
+	s.stats.deletes.Add(1)
+
+	c.notify(s.delete(key))
+}
+
+// Flush removes all items, all shards are locked so no write gets between shard flushes
+func (c *TypedCache[K, V]) Flush() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+	}
+
+	if c.log != nil {
+		c.log.flush()
+	}
+
+	var evicted []evictedEntry[K, V]
+	for _, s := range c.shards {
+		evicted = s.flushLocked(evicted)
+		s.mu.Unlock()
+	}
+
+	c.notify(evicted)
+}
+
+// setObserver attaches change observer to all shards, all shards are locked like in Flush
+func (c *TypedCache[K, V]) setObserver(observer changeObserver[K, V]) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+	}
+
+	for _, s := range c.shards {
+		s.observer = observer
+		s.mu.Unlock()
+	}
+}
+
+// setLog attaches change log to all shards, all shards are locked like in Flush
+func (c *TypedCache[K, V]) setLog(log changeLog[K, V]) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+	}
+
+	c.log = log
+
+	for _, s := range c.shards {
+		s.log = log
+		s.mu.Unlock()
+	}
+}
+
+// Evictions returns how many items were evicted to fit the cache limits
+func (c *TypedCache[K, V]) Evictions() uint64 {
+	var evictions uint64
+	for _, s := range c.shards {
+		evictions += s.stats.evictions.Load()
+	}
+
+	return evictions
+}
+
+// Close stops the background janitor, it is safe to call Close several times
+func (c *TypedCache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// janitor periodically removes expired items
+func (c *TypedCache[K, V]) janitor() {
+	ticker := time.NewTicker(c.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.deleteExpired()
+		}
+	}
+}
+
+// deleteExpired removes items whose timers are due in the shard timer wheels, the write lock
+// of a shard is held for one batch only and shards are expired while the time budget allows
+func (c *TypedCache[K, V]) deleteExpired() {
+	start := time.Now()
+
+	for i := 0; i < len(c.shards); i++ {
+		s := c.shards[c.janitorShard]
+		c.janitorShard = (c.janitorShard + 1) % len(c.shards)
+
+		for {
+			expired, done := s.expire(c.janitorBatchSize)
+			c.notify(expired)
+
+			if done {
+				break
+			}
+
+			if time.Since(start) >= c.janitorBudget {
+				return
+			}
+		}
+
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"hash/maphash"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	id   int
+	name string
+}
+
+func TestTypedCache(t *testing.T) {
+	cache := NewTyped[int, testUser]()
+	defer cache.Close()
+
+	cache.Set(1, testUser{id: 1, name: "user1"}, 0)
+	cache.Set(2, testUser{id: 2, name: "user2"}, TTL)
+
+	if got, gotOk := cache.Get(1); got != (testUser{id: 1, name: "user1"}) || gotOk != true {
+		t.Errorf("cache.Get(%d) = %v, %t, want %v, %t", 1, got, gotOk, testUser{id: 1, name: "user1"}, true)
+	}
+
+	cache.Delete(1)
+	if got, gotOk := cache.Get(1); got != (testUser{}) || gotOk != false {
+		t.Errorf("cache.Get(%d) = %v, %t, want %v, %t", 1, got, gotOk, testUser{}, false)
+	}
+
+	time.Sleep(TTL + 100*time.Millisecond)
+
+	if _, gotOk := cache.Get(2); gotOk != false {
+		t.Errorf("cache.Get(%d) = %t, want %t", 2, gotOk, false)
+	}
+}
+
+func TestTypedCacheEviction(t *testing.T) {
+	var evicted []int
+
+	cache := NewTyped[int, []byte](WithOptions[int, []byte](WithMaxEntries(2), WithShards(1)), WithKeyPolicy[int, []byte](NewLFUKeyPolicy[int]))
+	defer cache.Close()
+
+	cache.OnEvict(func(key int, value []byte, reason EvictReason) {
+		if reason == EvictCapacity {
+			evicted = append(evicted, key)
+		}
+	})
+
+	cache.Set(1, []byte("val1"), 0)
+	cache.Set(2, []byte("val2"), 0)
+	cache.Get(1)
+	cache.Set(3, []byte("val3"), 0)
+
+	if len(evicted) != 1 || evicted[0] != 2 {
+		t.Errorf("evicted = %v, want %v", evicted, []int{2})
+	}
+	if got := cache.Evictions(); got != 1 {
+		t.Errorf("cache.Evictions() = %d, want %d", got, 1)
+	}
+}
+
+func TestTypedCacheSizeFunc(t *testing.T) {
+	const items = 10
+
+	size := func(key int, value testUser) int64 {
+		return int64(len(value.name))
+	}
+
+	cache := NewTyped[int, testUser](WithOptions[int, testUser](WithMaxBytes(items*(10+entryOverhead)), WithShards(1)), WithSizeFunc(size))
+	defer cache.Close()
+
+	for i := 0; i < 2*items; i++ {
+		cache.Set(i, testUser{id: i, name: "0123456789"}, 0)
+	}
+
+	n := 0
+	for i := 0; i < 2*items; i++ {
+		if _, ok := cache.Get(i); ok {
+			n++
+		}
+	}
+	if n != items {
+		t.Errorf("cached items = %d, want %d", n, items)
+	}
+}
+
+func TestTypedCacheKeyHash(t *testing.T) {
+	hashed := 0
+	hash := func(key testUser) uint64 {
+		hashed++
+		return uint64(key.id)
+	}
+
+	cache := NewTyped[testUser, int](WithOptions[testUser, int](WithShards(4)), WithKeyHash[testUser, int](hash))
+	defer cache.Close()
+
+	for i := 0; i < 4; i++ {
+		cache.Set(testUser{id: i}, i, 0)
+	}
+
+	for i, s := range cache.shards {
+		if len(s.data) != 1 {
+			t.Errorf("shard %d items = %d, want %d", i, len(s.data), 1)
+		}
+	}
+	if got, gotOk := cache.Get(testUser{id: 3}); got != 3 || gotOk != true {
+		t.Errorf("cache.Get(%v) = %d, %t, want %d, %t", testUser{id: 3}, got, gotOk, 3, true)
+	}
+	if hashed != 5 {
+		t.Errorf("hashed keys = %d, want %d", hashed, 5)
+	}
+}
+
+func TestKeyHashAllocs(t *testing.T) {
+	hashString := newKeyHash[string](maphash.MakeSeed())
+	hashInt := newKeyHash[int](maphash.MakeSeed())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		hashString("key")
+		hashInt(1 << 20)
+	})
+	if allocs != 0 {
+		t.Errorf("key hash allocs = %v, want %v", allocs, 0)
+	}
+}
@@ -0,0 +1,168 @@
+package cache
+
+import "time"
+
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 4
+	// wheelSpan is how many ticks ahead the wheel can place a timer,
+	// later timers wait in the farthest slot and are placed again when it is cascaded
+	wheelSpan = 1 << (wheelBits * wheelLevels)
+)
+
+// clockBase is the origin of expiration times, they are measured on the monotonic clock,
+// so wall clock changes don't expire items early or keep them forever
+var clockBase = time.Now()
+
+// nanotime returns the monotonic time in nanoseconds since clockBase
+func nanotime() int64 {
+	return int64(time.Since(clockBase))
+}
+
+// timerNode is a scheduled expiration of a key, it is linked into the list of its slot
+type timerNode[K comparable] struct {
+	key  K
+	tick int64
+	// prev and next are nil when the timer is not scheduled
+	prev *timerNode[K]
+	next *timerNode[K]
+}
+
+// timerWheel is a hierarchical timing wheel: level 0 has a slot per tick, every next level
+// has a slot per full turn of the previous one. A timer goes to the lowest level which reaches
+// its tick and moves down a level when the wheel comes to its slot, so scheduling, removal
+// and expiration take amortized O(1). The wheel is guarded by the shard lock
+type timerWheel[K comparable] struct {
+	resolution int64
+	// tick is the next tick to expire
+	tick int64
+	// slots are sentinels of circular lists of timers
+	slots [wheelLevels][wheelSlots]timerNode[K]
+	len   int
+}
+
+func newTimerWheel[K comparable](resolution time.Duration) *timerWheel[K] {
+	w := &timerWheel[K]{resolution: int64(resolution)}
+	w.tick = nanotime()/w.resolution + 1
+	w.reset()
+
+	return w
+}
+
+// reset drops all timers
+func (w *timerWheel[K]) reset() {
+	for level := range w.slots {
+		for i := range w.slots[level] {
+			head := &w.slots[level][i]
+			head.prev, head.next = head, head
+		}
+	}
+	w.len = 0
+}
+
+// add schedules expiration of the key at expiresAt
+func (w *timerWheel[K]) add(key K, expiresAt int64) *timerNode[K] {
+	// the tick must start after expiresAt, an item is expired only when the time is past it
+	n := &timerNode[K]{key: key, tick: expiresAt/w.resolution + 1}
+	w.schedule(n)
+
+	return n
+}
+
+func (w *timerWheel[K]) schedule(n *timerNode[K]) {
+	tick := n.tick
+	if tick < w.tick {
+		tick = w.tick
+	}
+
+	delta := tick - w.tick
+	if delta >= wheelSpan {
+		tick = w.tick + wheelSpan - 1
+		delta = wheelSpan - 1
+	}
+
+	level := 0
+	for level < wheelLevels-1 && delta >= 1<<(wheelBits*(level+1)) {
+		level++
+	}
+
+	head := &w.slots[level][(tick>>(wheelBits*level))&wheelMask]
+	n.prev, n.next = head.prev, head
+	head.prev.next = n
+	head.prev = n
+	w.len++
+}
+
+// remove cancels the timer, it is a no-op for a timer which is not scheduled
+func (w *timerWheel[K]) remove(n *timerNode[K]) {
+	if n.next == nil {
+		return
+	}
+
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	n.prev, n.next = nil, nil
+	w.len--
+}
+
+// advance expires timers due at now calling expire for their keys, it stops after limit timers
+// and reports whether all due timers are expired, the next call goes on from the same place
+func (w *timerWheel[K]) advance(now int64, limit int, expire func(key K)) bool {
+	nowTick := now / w.resolution
+	expired := 0
+
+	for w.tick <= nowTick {
+		if w.len == 0 {
+			w.tick = nowTick + 1
+			break
+		}
+
+		w.cascade()
+
+		head := &w.slots[0][w.tick&wheelMask]
+		for head.next != head {
+			if expired >= limit {
+				return false
+			}
+
+			n := head.next
+			w.remove(n)
+			expire(n.key)
+			expired++
+		}
+
+		w.tick++
+	}
+
+	return true
+}
+
+// cascade moves timers of the higher level slots the wheel has come to down to lower levels,
+// the highest level goes first, so its timers can be moved down again by the next one
+func (w *timerWheel[K]) cascade() {
+	level := 1
+	for level < wheelLevels && w.tick&(1<<(wheelBits*level)-1) == 0 {
+		level++
+	}
+
+	for level--; level > 0; level-- {
+		head := &w.slots[level][(w.tick>>(wheelBits*level))&wheelMask]
+		if head.next == head {
+			continue
+		}
+
+		// the list is detached first, timers placed back to the same slot are not visited again
+		n := head.next
+		head.prev.next = nil
+		head.prev, head.next = head, head
+
+		for n != nil {
+			next := n.next
+			w.len--
+			w.schedule(n)
+			n = next
+		}
+	}
+}
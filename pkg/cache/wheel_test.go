@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestTimerWheel(t *testing.T) {
+	const timers = 5000
+
+	w := newTimerWheel[int](time.Millisecond)
+	res := w.resolution
+	start := w.tick * res
+
+	// deadlines cover all levels and go past the wheel span
+	rnd := rand.New(rand.NewSource(1))
+	deadlines := make(map[int]int64, timers)
+	nodes := make(map[int]*timerNode[int], timers)
+	for i := 0; i < timers; i++ {
+		var delta int64
+		switch i % 4 {
+		case 0:
+			delta = rnd.Int63n(wheelSlots * res)
+		case 1:
+			delta = rnd.Int63n(wheelSlots * wheelSlots * res)
+		case 2:
+			delta = rnd.Int63n(wheelSlots * wheelSlots * wheelSlots * res)
+		case 3:
+			delta = wheelSpan*res + rnd.Int63n(wheelSpan*res)
+		}
+
+		deadlines[i] = start + delta
+		nodes[i] = w.add(i, start+delta)
+	}
+
+	// every tenth timer is canceled
+	for i := 0; i < timers; i += 10 {
+		w.remove(nodes[i])
+		w.remove(nodes[i])
+		delete(deadlines, i)
+	}
+
+	expired := 0
+	now := start
+	// time moves in uneven steps, short ones while the lower levels expire,
+	// and the wheel is advanced in small batches
+	for w.len > 0 {
+		maxStep := int64(wheelSlots)
+		if now-start > wheelSlots*wheelSlots*wheelSlots*res {
+			maxStep = wheelSlots * wheelSlots * wheelSlots
+		}
+		step := rnd.Int63n(maxStep*res) + 1
+		now += step
+
+		for done := false; !done; {
+			done = w.advance(now, 7, func(key int) {
+				deadline, ok := deadlines[key]
+				if !ok {
+					t.Fatalf("timer %d expired twice or after remove", key)
+				}
+				if now <= deadline {
+					t.Fatalf("timer %d expired at %d, before its deadline %d", key, now, deadline)
+				}
+				// a timer may be late by the step and the tick rounding only
+				if now-deadline > step+2*res {
+					t.Fatalf("timer %d expired at %d, %d after its deadline", key, now, now-deadline)
+				}
+
+				delete(deadlines, key)
+				expired++
+			})
+		}
+	}
+
+	if len(deadlines) != 0 {
+		t.Errorf("timers not expired = %d, want %d", len(deadlines), 0)
+	}
+	if want := timers - timers/10; expired != want {
+		t.Errorf("timers expired = %d, want %d", expired, want)
+	}
+}
+
+func TestTTLRemaining(t *testing.T) {
+	cache := New()
+
+	cache.Set("key1", "val1", time.Hour)
+	cache.Set("key2", "val2", 0)
+
+	if ttl, ok := cache.TTL("key1"); ttl <= 0 || ttl > time.Hour || !ok {
+		t.Errorf("cache.TTL(%q) = %v, %t, want in (0, %v], %t", "key1", ttl, ok, time.Hour, true)
+	}
+	if ttl, ok := cache.TTL("key2"); ttl != 0 || !ok {
+		t.Errorf("cache.TTL(%q) = %v, %t, want %v, %t", "key2", ttl, ok, 0, true)
+	}
+	if _, ok := cache.TTL("key3"); ok {
+		t.Errorf("cache.TTL(%q) = %t, want %t", "key3", ok, false)
+	}
+}
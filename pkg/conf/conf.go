@@ -29,6 +29,19 @@ func IntValue(name string, defaultValue int) int {
 	return defaultValue
 }
 
+func FloatValue(name string, defaultValue float64) float64 {
+	if value, has := hasValue(name); has {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			panicBadEnvKey(name, err)
+		}
+
+		return v
+	}
+
+	return defaultValue
+}
+
 func StrValue(name, defaultValue string) string {
 	if value, has := hasValue(name); has {
 		return value
@@ -0,0 +1,49 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const protocol = "tcp"
+
+// dialer opens connections to memcached server for the pool
+type dialer struct {
+	addr string
+}
+
+func (d dialer) Dial(ctx context.Context) (net.Conn, error) {
+	var nd net.Dialer
+
+	return nd.DialContext(ctx, protocol, d.addr)
+}
+
+// Validate checks connection with version command round trip
+func (d dialer) Validate(ctx context.Context, conn net.Conn) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return errors.Wrap(ErrPing, err.Error())
+		}
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	_, err := fmt.Fprintf(conn, "version%s", EOL)
+	if err != nil {
+		return errors.Wrap(ErrConnWrite, err.Error())
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return errors.Wrap(ErrConnRead, err.Error())
+	}
+	if !strings.HasPrefix(line, ResponseVersion) {
+		return errors.Wrap(ErrPing, strings.TrimSuffix(line, EOL))
+	}
+
+	return nil
+}
@@ -3,14 +3,24 @@ package memcached
 import "github.com/pkg/errors"
 
 var (
-	ErrClient    = errors.New("memcached: client error")
-	ErrServer    = errors.New("memcached: server error")
-	ErrSet       = errors.New("memcached: unable to set key-value pair")
-	ErNewPool    = errors.New("memcached: unable to create connection pool")
-	ErrGetConn   = errors.New("memcached: unable to get connection from pool")
-	ErrConnWrite = errors.New("memcached: unable to write to connection")
-	ErrConnRead  = errors.New("memcached: unable to read from connection")
-	ErrGet       = errors.New("memcached: unable to get value from the store")
-	ErrDelete    = errors.New("memcached: unable to delete value")
-	ErrNotFound  = errors.New("memcached: value not found")
+	ErrClient       = errors.New("memcached: client error")
+	ErrServer       = errors.New("memcached: server error")
+	ErrSet          = errors.New("memcached: unable to set key-value pair")
+	ErNewPool       = errors.New("memcached: unable to create connection pool")
+	ErrMuxConns     = errors.New("memcached: multiplexed connections must leave pool connections for other commands")
+	ErrGetConn      = errors.New("memcached: unable to get connection from pool")
+	ErrConnWrite    = errors.New("memcached: unable to write to connection")
+	ErrConnRead     = errors.New("memcached: unable to read from connection")
+	ErrGet          = errors.New("memcached: unable to get value from the store")
+	ErrDelete       = errors.New("memcached: unable to delete value")
+	ErrNotFound     = errors.New("memcached: value not found")
+	ErrNotNumeric   = errors.New("memcached: value is not a number")
+	ErrIncr         = errors.New("memcached: unable to increment value")
+	ErrFlushAll     = errors.New("memcached: unable to flush items")
+	ErrKeys         = errors.New("memcached: unable to list keys")
+	ErrKeyMeta      = errors.New("memcached: bad metadump line")
+	ErrPing         = errors.New("memcached: connection health check failed")
+	ErrShutdown     = errors.New("memcached: connections in use were not returned before shutdown")
+	ErrCircuitOpen  = errors.New("memcached: circuit breaker is open")
+	ErrClientClosed = errors.New("memcached: client is closed")
 )
@@ -0,0 +1,142 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	noExpiration = -1
+
+	// responseBusy is the reply to metadump while the crawler is busy with another request
+	responseBusy = "BUSY"
+)
+
+// KeyMeta is item metadata from lru_crawler metadump
+type KeyMeta struct {
+	Key string
+	// Expiration is zero when the item never expires
+	Expiration time.Time
+	LastAccess time.Time
+	CAS        uint64
+	Fetched    bool
+	Class      int
+}
+
+// Keys streams metadata of all items stored on the server to fn,
+// iteration stops when fn returns false or ctx is done. The rest of the dump
+// isn't read then, so the connection is closed instead of returned to the pool
+func (c *Client) Keys(ctx context.Context, fn func(KeyMeta) bool) error {
+	res, err := c.getConn(ctx)
+	if err != nil {
+		return err
+	}
+
+	conn := res.Value()
+
+	if _, err := fmt.Fprintf(conn, "lru_crawler metadump all%s", EOL); err != nil {
+		c.pool.Discard(res)
+		return errors.Wrap(ErrConnWrite, err.Error())
+	}
+
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			c.pool.Discard(res)
+			return errors.Wrap(ErrConnRead, err.Error())
+		}
+
+		if line == ResponseEnd {
+			c.pool.Put(res)
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			c.pool.Drop(res)
+			return err
+		}
+
+		if errorReply(line) {
+			// the whole reply is one line of a working server, so the connection is usable
+			c.pool.Put(res)
+			return errors.Wrap(ErrKeys, strings.TrimSuffix(line, EOL))
+		}
+
+		meta, err := parseKeyMeta(strings.TrimSuffix(line, EOL))
+		if err != nil {
+			c.pool.Drop(res)
+			return errors.Wrap(ErrKeys, err.Error())
+		}
+
+		if !fn(meta) {
+			c.pool.Drop(res)
+			return nil
+		}
+	}
+}
+
+func errorReply(line string) bool {
+	for _, prefix := range []string{responseBusy, ResponseError, ResponseClientError, ResponseServerError} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseKeyMeta parses metadump line like
+// key=foo exp=-1 la=1677052345 cas=2 fetch=no cls=1 size=63
+func parseKeyMeta(line string) (KeyMeta, error) {
+	var meta KeyMeta
+	hasKey := false
+
+	for _, field := range strings.Fields(line) {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return KeyMeta{}, errors.Wrap(ErrKeyMeta, line)
+		}
+
+		var err error
+
+		switch name {
+		case "key":
+			meta.Key, err = url.QueryUnescape(value)
+			hasKey = true
+		case "exp":
+			var exp int64
+			if exp, err = strconv.ParseInt(value, 10, 64); err == nil && exp != noExpiration {
+				meta.Expiration = time.Unix(exp, 0)
+			}
+		case "la":
+			var la int64
+			if la, err = strconv.ParseInt(value, 10, 64); err == nil {
+				meta.LastAccess = time.Unix(la, 0)
+			}
+		case "cas":
+			meta.CAS, err = strconv.ParseUint(value, 10, 64)
+		case "fetch":
+			meta.Fetched = value == "yes"
+		case "cls":
+			meta.Class, err = strconv.Atoi(value)
+		}
+
+		if err != nil {
+			return KeyMeta{}, errors.Wrap(ErrKeyMeta, line)
+		}
+	}
+
+	if !hasKey {
+		return KeyMeta{}, errors.Wrap(ErrKeyMeta, line)
+	}
+
+	return meta, nil
+}
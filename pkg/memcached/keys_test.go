@@ -0,0 +1,122 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/swanden/storage/pkg/pool"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveMetadump starts a server which answers metadump with busy replies first
+// and then with a dump of keys items
+func serveMetadump(t *testing.T, busy, keys int) (string, int) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				w := bufio.NewWriter(conn)
+
+				for {
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+
+					if busy > 0 {
+						busy--
+						fmt.Fprintf(w, "%s currently processing crawler request%s", responseBusy, EOL)
+					} else {
+						for i := 0; i < keys; i++ {
+							fmt.Fprintf(w, "key=key%d exp=-1 la=1677052345 cas=%d fetch=no cls=1 size=63%s", i, i, EOL)
+						}
+						w.WriteString(ResponseEnd)
+					}
+
+					if err := w.Flush(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+
+	return addr.IP.String(), addr.Port
+}
+
+func TestKeysBusy(t *testing.T) {
+	const busy = 3
+
+	host, port := serveMetadump(t, busy, 10)
+
+	client, err := Connect(host, WithPort(port), WithCircuitBreaker(0.5, 2, time.Minute))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	count := func(KeyMeta) bool { return true }
+
+	for i := 0; i < busy; i++ {
+		if err := client.Keys(ctx, count); !errors.Is(err, ErrKeys) {
+			t.Errorf("client.Keys() = %v, want %v", err, ErrKeys)
+		}
+	}
+
+	n := 0
+	if err := client.Keys(ctx, func(KeyMeta) bool { n++; return true }); err != nil || n != 10 {
+		t.Errorf("client.Keys() = %v with %d keys, want %v with %d keys", err, n, nil, 10)
+	}
+
+	if stats := client.PoolStats(); stats.BreakerState != pool.BreakerClosed || stats.Dials != 1 {
+		t.Errorf("client.PoolStats() = breaker %s, %d dials, want %s, %d", stats.BreakerState, stats.Dials, pool.BreakerClosed, 1)
+	}
+}
+
+func TestKeysStop(t *testing.T) {
+	host, port := serveMetadump(t, 0, 100_000)
+
+	client, err := Connect(host, WithPort(port), WithCircuitBreaker(0.5, 2, time.Minute))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Keys(context.Background(), func(KeyMeta) bool { return false }); err != nil {
+		t.Errorf("client.Keys() stopped by fn = %v, want %v", err, nil)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.Keys(ctx, func(KeyMeta) bool {
+		cancel()
+		return true
+	})
+	if err != context.Canceled {
+		t.Errorf("client.Keys() stopped by ctx = %v, want %v", err, context.Canceled)
+	}
+
+	// stopped dumps are not read to the end, their connections are closed without breaker failures
+	if stats := client.PoolStats(); stats.OpenConns != 0 || stats.BreakerState != pool.BreakerClosed {
+		t.Errorf("client.PoolStats() = %d open conns, breaker %s, want %d, %s", stats.OpenConns, stats.BreakerState, 0, pool.BreakerClosed)
+	}
+}
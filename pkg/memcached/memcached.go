@@ -5,9 +5,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/pkg/errors"
-	"github.com/swanden/storage/pkg/memcached/pool"
+	"github.com/swanden/storage/pkg/pool"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,6 +17,7 @@ const (
 	defaultPort             = 11211
 	defaultMaxIdleConns     = 10
 	defaultMaxOpenConns     = 10
+	defaultMaxWaiters       = 10_000
 	defaultNewConnTimeout   = 3000 * time.Millisecond
 	defaultConnRetryTimeout = 3000 * time.Millisecond
 
@@ -24,6 +26,8 @@ const (
 	ResponseStored      = "STORED" + EOL
 	ResponseNotFound    = "NOT_FOUND" + EOL
 	ResponseDeleted     = "DELETED" + EOL
+	ResponseOK          = "OK" + EOL
+	ResponseVersion     = "VERSION "
 	ResponseError       = "ERROR"
 	ResponseClientError = "CLIENT_ERROR"
 	ResponseServerError = "SERVER_ERROR"
@@ -31,13 +35,28 @@ const (
 )
 
 type Client struct {
-	host             string
-	port             int
-	maxIdleConns     int
-	maxOpenConns     int
-	newConnTimeout   time.Duration
-	connRetryTimeout time.Duration
-	pool             *pool.Pool
+	host                     string
+	port                     int
+	maxIdleConns             int
+	maxOpenConns             int
+	maxWaiters               int
+	minIdleConns             int
+	warmupCtx                context.Context
+	newConnTimeout           time.Duration
+	connRetryTimeout         time.Duration
+	maxIdleTime              time.Duration
+	maxConnLifetime          time.Duration
+	healthCheckIdleThreshold time.Duration
+	keepaliveInterval        time.Duration
+	breakerFailureRatio      float64
+	breakerMinRequests       int
+	breakerWindow            time.Duration
+	breakerOpenTimeout       time.Duration
+	breakerHalfOpenRequests  int
+	breakerStateHook         pool.BreakerStateHook
+	multiplexedConns         int
+	mux                      *multiplexer
+	pool                     *pool.Pool[net.Conn]
 }
 
 func Connect(host string, opts ...Option) (*Client, error) {
@@ -46,6 +65,7 @@ func Connect(host string, opts ...Option) (*Client, error) {
 		port:             defaultPort,
 		maxIdleConns:     defaultMaxIdleConns,
 		maxOpenConns:     defaultMaxOpenConns,
+		maxWaiters:       defaultMaxWaiters,
 		newConnTimeout:   defaultNewConnTimeout,
 		connRetryTimeout: defaultConnRetryTimeout,
 	}
@@ -54,31 +74,70 @@ func Connect(host string, opts ...Option) (*Client, error) {
 		opt(client)
 	}
 
-	connPool, err := pool.NewPool(
-		client.host,
-		pool.WithPort(client.port),
+	if client.multiplexedConns > 0 && client.maxOpenConns > 0 && client.multiplexedConns >= client.maxOpenConns {
+		return nil, ErrMuxConns
+	}
+
+	poolOpts := []pool.Option{
 		pool.WithMaxIdleConns(client.maxIdleConns),
 		pool.WithMaxOpenConns(client.maxOpenConns),
+		pool.WithMinIdleConns(client.minIdleConns),
+		pool.WithMaxWaiters(client.maxWaiters),
 		pool.WithNewConnTimeout(client.newConnTimeout),
 		pool.WithConnRetryTimeout(client.connRetryTimeout),
-	)
+		pool.WithMaxIdleTime(client.maxIdleTime),
+		pool.WithMaxConnLifetime(client.maxConnLifetime),
+		pool.WithHealthCheckIdleThreshold(client.healthCheckIdleThreshold),
+		pool.WithKeepaliveInterval(client.keepaliveInterval),
+		pool.WithBreakerFailureRatio(client.breakerFailureRatio),
+		pool.WithBreakerStateHook(client.breakerStateHook),
+	}
+	if client.breakerMinRequests > 0 {
+		poolOpts = append(poolOpts, pool.WithBreakerMinRequests(client.breakerMinRequests))
+	}
+	if client.breakerWindow > 0 {
+		poolOpts = append(poolOpts, pool.WithBreakerWindow(client.breakerWindow))
+	}
+	if client.breakerOpenTimeout > 0 {
+		poolOpts = append(poolOpts, pool.WithBreakerOpenTimeout(client.breakerOpenTimeout))
+	}
+	if client.breakerHalfOpenRequests > 0 {
+		poolOpts = append(poolOpts, pool.WithBreakerHalfOpenRequests(client.breakerHalfOpenRequests))
+	}
+	if client.warmupCtx != nil {
+		poolOpts = append(poolOpts, pool.WithWarmup(client.warmupCtx))
+	}
+
+	addr := net.JoinHostPort(client.host, strconv.Itoa(client.port))
+
+	connPool, err := pool.New[net.Conn](dialer{addr: addr}, poolOpts...)
 	if err != nil {
 		return nil, errors.Wrap(ErNewPool, err.Error())
 	}
 
 	client.pool = connPool
 
+	if client.multiplexedConns > 0 {
+		client.mux = newMultiplexer(client.multiplexedConns, client)
+	}
+
 	return client, nil
 }
 
 // Set sets key-value pair
 // ttl - expiration time in seconds, if 0 - no expire time
 func (c *Client) Set(ctx context.Context, key string, value string, ttl int) error {
-	conn, err := c.pool.Get(ctx)
+	if c.mux != nil {
+		return c.mux.set(ctx, key, value, ttl)
+	}
+
+	res, err := c.getConn(ctx)
 	if err != nil {
-		return errors.Wrap(ErrGetConn, err.Error())
+		return err
 	}
-	defer c.pool.Put(conn)
+	defer func() { c.release(res, err) }()
+
+	conn := res.Value()
 
 	_, err = fmt.Fprintf(conn, "set %s %d %d %d%s%s%s", key, Metadata, ttl, len(value), EOL, value, EOL)
 	if err != nil {
@@ -97,11 +156,17 @@ func (c *Client) Set(ctx context.Context, key string, value string, ttl int) err
 }
 
 func (c *Client) Get(ctx context.Context, key string) (string, error) {
-	conn, err := c.pool.Get(ctx)
+	if c.mux != nil {
+		return c.mux.get(ctx, key)
+	}
+
+	res, err := c.getConn(ctx)
 	if err != nil {
-		return "", errors.Wrap(ErrGetConn, err.Error())
+		return "", err
 	}
-	defer c.pool.Put(conn)
+	defer func() { c.release(res, err) }()
+
+	conn := res.Value()
 
 	_, err = fmt.Fprintf(conn, "get %s%s", key, EOL)
 	if err != nil {
@@ -126,11 +191,17 @@ func (c *Client) Get(ctx context.Context, key string) (string, error) {
 }
 
 func (c *Client) Delete(ctx context.Context, key string) error {
-	conn, err := c.pool.Get(ctx)
+	if c.mux != nil {
+		return c.mux.delete(ctx, key)
+	}
+
+	res, err := c.getConn(ctx)
 	if err != nil {
-		return errors.Wrap(ErrGetConn, err.Error())
+		return err
 	}
-	defer c.pool.Put(conn)
+	defer func() { c.release(res, err) }()
+
+	conn := res.Value()
 
 	_, err = fmt.Fprintf(conn, "delete %s%s", key, EOL)
 	if err != nil {
@@ -145,6 +216,103 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// Incr adds delta to the numeric value of the key, the result wraps around at 64 bits.
+// The item keeps its expiration time
+func (c *Client) Incr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.incr(ctx, "incr", key, delta)
+}
+
+// Decr subtracts delta from the numeric value of the key, the result doesn't go below 0.
+// The item keeps its expiration time
+func (c *Client) Decr(ctx context.Context, key string, delta uint64) (uint64, error) {
+	return c.incr(ctx, "decr", key, delta)
+}
+
+func (c *Client) incr(ctx context.Context, command, key string, delta uint64) (uint64, error) {
+	res, err := c.getConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { c.release(res, err) }()
+
+	conn := res.Value()
+
+	_, err = fmt.Fprintf(conn, "%s %s %d%s", command, key, delta, EOL)
+	if err != nil {
+		return 0, errors.Wrap(ErrConnWrite, err.Error())
+	}
+
+	line, err := readReply(conn)
+	if errors.Is(err, ErrClient) && strings.Contains(err.Error(), "non-numeric") {
+		return 0, ErrNotNumeric
+	}
+	if err != nil {
+		return 0, errors.Wrap(ErrIncr, err.Error())
+	}
+	if line == ResponseNotFound {
+		return 0, ErrNotFound
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSuffix(line, EOL), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(ErrIncr, err.Error())
+	}
+
+	return value, nil
+}
+
+// FlushAll invalidates all existing items on the server
+func (c *Client) FlushAll(ctx context.Context) error {
+	res, err := c.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { c.release(res, err) }()
+
+	conn := res.Value()
+
+	_, err = fmt.Fprintf(conn, "flush_all%s", EOL)
+	if err != nil {
+		return errors.Wrap(ErrConnWrite, err.Error())
+	}
+
+	line, err := readReply(conn)
+	if err != nil {
+		return errors.Wrap(ErrFlushAll, err.Error())
+	}
+	if line != ResponseOK {
+		err = errors.Wrap(ErrFlushAll, strings.TrimSuffix(line, EOL))
+		return err
+	}
+
+	return nil
+}
+
+// getConn borrows a connection from the pool
+func (c *Client) getConn(ctx context.Context) (*pool.Resource[net.Conn], error) {
+	res, err := c.pool.Get(ctx)
+	if errors.Is(err, pool.ErrCircuitOpen) {
+		return nil, ErrCircuitOpen
+	}
+	if err != nil {
+		return nil, errors.Wrap(ErrGetConn, err.Error())
+	}
+
+	return res, nil
+}
+
+// release returns connection to the pool, connections which failed
+// on read or write are closed and counted by the circuit breaker,
+// error responses of the server leave connection usable
+func (c *Client) release(res *pool.Resource[net.Conn], err error) {
+	if err == nil || errors.Is(err, ErrClient) || errors.Is(err, ErrServer) {
+		c.pool.Put(res)
+		return
+	}
+
+	c.pool.Discard(res)
+}
+
 func getData(resp string) (string, bool) {
 	resp = strings.ReplaceAll(resp, ResponseEnd, "")
 	data := strings.Split(resp, "\r\n")
@@ -155,6 +323,29 @@ func getData(resp string) (string, bool) {
 	return "", false
 }
 
+// readReply reads a reply of one line, it is read byte by byte
+// so nothing after the line is consumed from the connection
+func readReply(conn net.Conn) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+
+	for !bytes.HasSuffix(line, []byte(EOL)) {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", errors.Wrap(ErrConnRead, err.Error())
+		}
+		line = append(line, b[0])
+	}
+
+	switch {
+	case strings.HasPrefix(string(line), ResponseError), strings.HasPrefix(string(line), ResponseClientError):
+		return "", errors.Wrap(ErrClient, strings.TrimSuffix(string(line), EOL))
+	case strings.HasPrefix(string(line), ResponseServerError):
+		return "", errors.Wrap(ErrServer, strings.TrimSuffix(string(line), EOL))
+	}
+
+	return string(line), nil
+}
+
 func (c *Client) getResponse(conn net.Conn) ([]byte, error) {
 	tmp := make([]byte, 1024)
 	data := make([]byte, 0)
@@ -191,6 +382,42 @@ func (c *Client) getResponse(conn net.Conn) ([]byte, error) {
 	return data, nil
 }
 
+// SetMaxOpenConns changes max open connections of the pool at runtime
+func (c *Client) SetMaxOpenConns(n int) {
+	c.pool.SetMaxOpenConns(n)
+}
+
+// SetMaxIdleConns changes max idle connections of the pool at runtime
+func (c *Client) SetMaxIdleConns(n int) {
+	c.pool.SetMaxIdleConns(n)
+}
+
+// PoolStats returns connection pool statistics
+func (c *Client) PoolStats() pool.PoolStats {
+	return c.pool.Stats()
+}
+
+// Close closes idle connections, connections in use are closed when they are returned
 func (c *Client) Close() {
 	c.pool.Close()
+	if c.mux != nil {
+		c.mux.close()
+	}
+}
+
+// Shutdown closes the client and waits for connections in use,
+// when ctx is done they are force-closed
+func (c *Client) Shutdown(ctx context.Context) error {
+	// the pool is closed first, so multiplexed connections are closed
+	// when their requests in flight are done
+	c.pool.Close()
+	if c.mux != nil {
+		c.mux.close()
+	}
+
+	if err := c.pool.Shutdown(ctx); err != nil {
+		return errors.Wrap(ErrShutdown, err.Error())
+	}
+
+	return nil
 }
@@ -202,3 +202,87 @@ func TestMemcached(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestKeys(t *testing.T) {
+	type Test struct {
+		key   string
+		value string
+	}
+
+	tests := []Test{
+		{"keys_key11", "val11"},
+		{"keys_key12", "val12"},
+		{"keys_key13", "val13"},
+	}
+
+	client, err := Connect(
+		host,
+		WithPort(port),
+		WithMaxIdleConns(maxIdleConns),
+		WithMaxOpenConns(maxOpenConns),
+	)
+	if err != nil {
+		t.Fatalf("unable to connect to memcached server: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	for _, test := range tests {
+		if err = client.Set(ctx, test.key, test.value, 0); err != nil {
+			t.Fatalf("unable to set key: %q value: %q : %v", test.key, test.value, err)
+		}
+	}
+
+	found := make(map[string]bool)
+	err = client.Keys(ctx, func(meta KeyMeta) bool {
+		found[meta.Key] = true
+		return true
+	})
+	if err != nil {
+		t.Fatalf("client.Keys() = %v, want %v", err, nil)
+	}
+
+	for _, test := range tests {
+		if !found[test.key] {
+			t.Fatalf("client.Keys() didn't return key %q", test.key)
+		}
+	}
+}
+
+func TestParseKeyMeta(t *testing.T) {
+	type Test struct {
+		line    string
+		want    KeyMeta
+		wantErr bool
+	}
+
+	tests := []Test{
+		{
+			"key=key11 exp=-1 la=1677052345 cas=2 fetch=no cls=1 size=63",
+			KeyMeta{Key: "key11", LastAccess: time.Unix(1677052345, 0), CAS: 2, Class: 1},
+			false,
+		},
+		{
+			"key=key%2012 exp=1677052400 la=1677052345 cas=3 fetch=yes cls=2 size=70",
+			KeyMeta{
+				Key:        "key 12",
+				Expiration: time.Unix(1677052400, 0),
+				LastAccess: time.Unix(1677052345, 0),
+				CAS:        3,
+				Fetched:    true,
+				Class:      2,
+			},
+			false,
+		},
+		{"BUSY currently processing crawler request", KeyMeta{}, true},
+		{"key=key13 exp=never", KeyMeta{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseKeyMeta(test.line)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("parseKeyMeta(%q) = %+v, %v, want %+v, error %t", test.line, got, err, test.want, test.wantErr)
+		}
+	}
+}
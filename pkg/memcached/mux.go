@@ -0,0 +1,491 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/swanden/storage/pkg/pool"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	maxMuxPending  = 4096
+	muxBufferSize  = 16 * 1024
+	metaOpaqueFlag = "O"
+
+	metaStored   = "HD"
+	metaValue    = "VA"
+	metaMiss     = "EN"
+	metaNotFound = "NF"
+)
+
+// multiplexer shares a few connections between all requests,
+// requests are sent with meta protocol commands tagged with opaque tokens.
+// The connections are borrowed from the client pool, so they are dialed through
+// the circuit breaker and counted in pool statistics
+type multiplexer struct {
+	conns []*muxConn
+	next  atomic.Uint64
+}
+
+func newMultiplexer(n int, client *Client) *multiplexer {
+	m := &multiplexer{conns: make([]*muxConn, n)}
+	for i := range m.conns {
+		m.conns[i] = &muxConn{client: client}
+	}
+
+	return m
+}
+
+func (m *multiplexer) conn() *muxConn {
+	return m.conns[m.next.Add(1)%uint64(len(m.conns))]
+}
+
+func (m *multiplexer) set(ctx context.Context, key, value string, ttl int) error {
+	var b strings.Builder
+	b.WriteString("ms " + key + " " + strconv.Itoa(len(value)))
+	if ttl != 0 {
+		b.WriteString(" T" + strconv.Itoa(ttl))
+	}
+
+	resp, err := m.conn().do(ctx, b.String(), value+EOL)
+	if err != nil {
+		return muxError(ErrSet, err)
+	}
+	if resp.code != metaStored {
+		return errors.Wrap(ErrSet, resp.code)
+	}
+
+	return nil
+}
+
+func (m *multiplexer) get(ctx context.Context, key string) (string, error) {
+	resp, err := m.conn().do(ctx, "mg "+key+" v", "")
+	if err != nil {
+		return "", muxError(ErrGet, err)
+	}
+
+	switch resp.code {
+	case metaValue:
+		return string(resp.value), nil
+	case metaMiss:
+		return "", ErrNotFound
+	default:
+		return "", errors.Wrap(ErrGet, resp.code)
+	}
+}
+
+func (m *multiplexer) delete(ctx context.Context, key string) error {
+	resp, err := m.conn().do(ctx, "md "+key, "")
+	if err != nil {
+		return muxError(ErrDelete, err)
+	}
+	if resp.code != metaStored && resp.code != metaNotFound {
+		return errors.Wrap(ErrDelete, resp.code)
+	}
+
+	return nil
+}
+
+// muxError wraps request error with the command error, open circuit breaker
+// and closed client are returned as is like for pooled requests
+func muxError(cmdErr, err error) error {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrClientClosed) {
+		return err
+	}
+
+	return errors.Wrap(cmdErr, err.Error())
+}
+
+// close stops taking requests, sessions give their connections back to the pool
+// when requests in flight are answered. The pool must be closed before,
+// so it closes the connections instead of keeping them idle
+func (m *multiplexer) close() {
+	for _, c := range m.conns {
+		c.close()
+	}
+}
+
+// muxConn is a connection shared by many requests, it is dialed on the first request
+// and dialed again on the next request after a failure
+type muxConn struct {
+	client *Client
+
+	mu      sync.Mutex
+	session *muxSession
+	// dialing is the dial in progress, requests wait for it instead of dialing again
+	dialing *muxDial
+	closed  bool
+	opaque  uint32
+}
+
+type muxDial struct {
+	done    chan struct{}
+	session *muxSession
+	err     error
+}
+
+type muxRequest struct {
+	opaque string
+	// data is a full request with command line and value block
+	data []byte
+	done chan muxResponse
+}
+
+type muxResponse struct {
+	code  string
+	value []byte
+	err   error
+}
+
+// do sends command line tagged with opaque token followed by data block and waits for the response
+func (c *muxConn) do(ctx context.Context, command, block string) (muxResponse, error) {
+	s, err := c.getSession(ctx)
+	if err != nil {
+		return muxResponse{}, err
+	}
+
+	if err := s.acquire(); err != nil {
+		return muxResponse{}, err
+	}
+	defer s.release()
+
+	c.mu.Lock()
+	c.opaque++
+	opaque := strconv.FormatUint(uint64(c.opaque), 10)
+	c.mu.Unlock()
+
+	req := &muxRequest{
+		opaque: opaque,
+		data:   []byte(command + " " + metaOpaqueFlag + opaque + EOL + block),
+		done:   make(chan muxResponse, 1),
+	}
+
+	select {
+	case s.requests <- req:
+	case <-s.failed:
+		return muxResponse{}, s.err
+	case <-ctx.Done():
+		return muxResponse{}, ctx.Err()
+	}
+
+	select {
+	case resp := <-req.done:
+		return resp, resp.err
+	case <-s.failed:
+		select {
+		case resp := <-req.done:
+			return resp, resp.err
+		default:
+			return muxResponse{}, s.err
+		}
+	case <-ctx.Done():
+		// the response is read and dropped by the reader
+		return muxResponse{}, ctx.Err()
+	}
+}
+
+// getSession returns the live session or waits for a new one, only one dial runs at a time
+// and requests which come meanwhile get its result, waiting is stopped when ctx is done
+func (c *muxConn) getSession(ctx context.Context) (*muxSession, error) {
+	c.mu.Lock()
+
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+
+	if c.session != nil && c.session.alive() {
+		s := c.session
+		c.mu.Unlock()
+		return s, nil
+	}
+
+	d := c.dialing
+	if d == nil {
+		d = &muxDial{done: make(chan struct{})}
+		c.dialing = d
+		go c.dial(d)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return d.session, d.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dial borrows a connection from the pool, it isn't bound to the context of the request
+// which started it, as other requests wait for it too, the pool limits it with its timeouts
+func (c *muxConn) dial(d *muxDial) {
+	res, err := c.client.getConn(context.Background())
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dialing = nil
+
+	switch {
+	case err != nil:
+		d.err = err
+	case c.closed:
+		c.client.pool.Put(res)
+		d.err = ErrClientClosed
+	default:
+		c.session = newMuxSession(res, c.client.pool)
+		d.session = c.session
+	}
+
+	close(d.done)
+}
+
+func (c *muxConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.session != nil {
+		c.session.shutdown()
+	}
+}
+
+// muxSession runs writer and reader of one connection, requests are written in batches
+// and memcached answers them in order, so the reader matches responses with pending
+// requests in FIFO order and verifies opaque tokens
+type muxSession struct {
+	res      *pool.Resource[net.Conn]
+	pool     *pool.Pool[net.Conn]
+	conn     net.Conn
+	requests chan *muxRequest
+	pending  chan *muxRequest
+
+	mu sync.Mutex
+	// inflight is the number of requests using the session, a closing session
+	// ends when they are done
+	inflight int
+	closing  bool
+
+	once   sync.Once
+	failed chan struct{}
+	err    error
+}
+
+func newMuxSession(res *pool.Resource[net.Conn], p *pool.Pool[net.Conn]) *muxSession {
+	s := &muxSession{
+		res:      res,
+		pool:     p,
+		conn:     res.Value(),
+		requests: make(chan *muxRequest),
+		pending:  make(chan *muxRequest, maxMuxPending),
+		failed:   make(chan struct{}),
+	}
+
+	go s.write()
+	go s.read()
+
+	return s
+}
+
+func (s *muxSession) alive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.failed:
+		return false
+	default:
+		return !s.closing
+	}
+}
+
+// acquire counts a request in flight, it fails when the session is closing or failed
+func (s *muxSession) acquire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.failed:
+		return s.err
+	default:
+	}
+
+	if s.closing {
+		return ErrClientClosed
+	}
+	s.inflight++
+
+	return nil
+}
+
+func (s *muxSession) release() {
+	s.mu.Lock()
+	s.inflight--
+	drained := s.closing && s.inflight == 0
+	s.mu.Unlock()
+
+	if drained {
+		s.end(ErrClientClosed, false)
+	}
+}
+
+// shutdown stops taking requests and ends the session when requests in flight are done
+func (s *muxSession) shutdown() {
+	s.mu.Lock()
+	s.closing = true
+	drained := s.inflight == 0
+	s.mu.Unlock()
+
+	if drained {
+		s.end(ErrClientClosed, false)
+	}
+}
+
+func (s *muxSession) fail(err error) {
+	s.end(err, true)
+}
+
+// end fails requests waiting for the session and gives the connection back to the pool,
+// a broken connection is discarded and counted by the circuit breaker
+func (s *muxSession) end(err error, broken bool) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.failed)
+
+		if broken {
+			s.pool.Discard(s.res)
+		} else {
+			s.pool.Put(s.res)
+		}
+	})
+}
+
+func (s *muxSession) write() {
+	w := bufio.NewWriterSize(s.conn, muxBufferSize)
+
+	for {
+		var req *muxRequest
+
+		select {
+		case req = <-s.requests:
+		case <-s.failed:
+			return
+		}
+
+		// requests which are already waiting go to the same batch
+		for req != nil {
+			select {
+			case s.pending <- req:
+			case <-s.failed:
+				return
+			}
+
+			if _, err := w.Write(req.data); err != nil {
+				s.fail(errors.Wrap(ErrConnWrite, err.Error()))
+				return
+			}
+
+			select {
+			case req = <-s.requests:
+			default:
+				req = nil
+			}
+		}
+
+		if err := w.Flush(); err != nil {
+			s.fail(errors.Wrap(ErrConnWrite, err.Error()))
+			return
+		}
+	}
+}
+
+func (s *muxSession) read() {
+	r := bufio.NewReaderSize(s.conn, muxBufferSize)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			s.fail(errors.Wrap(ErrConnRead, err.Error()))
+			return
+		}
+
+		var req *muxRequest
+		select {
+		case req = <-s.pending:
+		default:
+			s.fail(errors.Wrap(ErrServer, "unexpected response: "+strings.TrimSuffix(line, EOL)))
+			return
+		}
+
+		resp, fatal := parseMetaResponse(r, line, req.opaque)
+		req.done <- resp
+
+		if fatal != nil {
+			s.fail(fatal)
+			return
+		}
+	}
+}
+
+// parseMetaResponse reads meta protocol response, fatal error means
+// the connection can't be used anymore
+func parseMetaResponse(r *bufio.Reader, line, opaque string) (muxResponse, error) {
+	line = strings.TrimSuffix(line, EOL)
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		err := errors.Wrap(ErrServer, "empty response")
+		return muxResponse{err: err}, err
+	}
+
+	code, flags := fields[0], fields[1:]
+
+	// a client error is caused by the request, like a bad key, so only it fails,
+	// while an unknown command means the stream is out of sync
+	switch {
+	case code == ResponseError:
+		err := errors.Wrap(ErrClient, line)
+		return muxResponse{err: err}, err
+	case code == ResponseClientError:
+		return muxResponse{err: errors.Wrap(ErrClient, line)}, nil
+	case code == ResponseServerError:
+		return muxResponse{err: errors.Wrap(ErrServer, line)}, nil
+	}
+
+	resp := muxResponse{code: code}
+
+	if code == metaValue {
+		if len(flags) == 0 {
+			err := errors.Wrap(ErrServer, "bad value response: "+line)
+			return muxResponse{err: err}, err
+		}
+
+		size, err := strconv.Atoi(flags[0])
+		if err != nil {
+			err = errors.Wrap(ErrServer, "bad value size: "+line)
+			return muxResponse{err: err}, err
+		}
+		flags = flags[1:]
+
+		resp.value = make([]byte, size+len(EOL))
+		if _, err := io.ReadFull(r, resp.value); err != nil {
+			err = errors.Wrap(ErrConnRead, err.Error())
+			return muxResponse{err: err}, err
+		}
+		resp.value = resp.value[:size]
+	}
+
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, metaOpaqueFlag) && flag[len(metaOpaqueFlag):] != opaque {
+			err := errors.Wrap(ErrServer, "opaque mismatch: "+line)
+			return muxResponse{err: err}, err
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,251 @@
+package memcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveMeta starts a server which understands ms, mg and md meta commands,
+// it answers a client error for key "bad" and gets key "slow" with a delay
+func serveMeta(t *testing.T) (string, int) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { lis.Close() })
+
+	var mu sync.Mutex
+	items := make(map[string]string)
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				w := bufio.NewWriter(conn)
+
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+
+					fields := strings.Fields(line)
+					opaque := fields[len(fields)-1]
+
+					if fields[1] == "slow" {
+						time.Sleep(100 * time.Millisecond)
+					}
+
+					mu.Lock()
+					switch {
+					case fields[1] == "bad":
+						fmt.Fprintf(w, "CLIENT_ERROR bad command line format%s", EOL)
+					case fields[0] == "ms":
+						size, _ := strconv.Atoi(fields[2])
+						data := make([]byte, size+len(EOL))
+						if _, err := io.ReadFull(r, data); err != nil {
+							mu.Unlock()
+							return
+						}
+						items[fields[1]] = string(data[:size])
+						fmt.Fprintf(w, "HD %s%s", opaque, EOL)
+					case fields[0] == "mg":
+						if value, ok := items[fields[1]]; ok {
+							fmt.Fprintf(w, "VA %d %s%s%s%s", len(value), opaque, EOL, value, EOL)
+						} else {
+							fmt.Fprintf(w, "EN %s%s", opaque, EOL)
+						}
+					case fields[0] == "md":
+						if _, ok := items[fields[1]]; ok {
+							delete(items, fields[1])
+							fmt.Fprintf(w, "HD %s%s", opaque, EOL)
+						} else {
+							fmt.Fprintf(w, "NF %s%s", opaque, EOL)
+						}
+					}
+					mu.Unlock()
+
+					if r.Buffered() == 0 {
+						if err := w.Flush(); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+
+	addr := lis.Addr().(*net.TCPAddr)
+
+	return addr.IP.String(), addr.Port
+}
+
+func TestMultiplexed(t *testing.T) {
+	const workers = 50
+
+	host, port := serveMeta(t)
+
+	client, err := Connect(host, WithPort(port), WithMultiplexedConns(2))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key, value := fmt.Sprintf("key%d", i), fmt.Sprintf("value\r\n%d", i)
+
+			if err := client.Set(ctx, key, value, 0); err != nil {
+				t.Errorf("client.Set(%q) = %v, want %v", key, err, nil)
+				return
+			}
+			if got, err := client.Get(ctx, key); got != value || err != nil {
+				t.Errorf("client.Get(%q) = %q, %v, want %q, %v", key, got, err, value, nil)
+			}
+			if err := client.Delete(ctx, key); err != nil {
+				t.Errorf("client.Delete(%q) = %v, want %v", key, err, nil)
+			}
+			if _, err := client.Get(ctx, key); err != ErrNotFound {
+				t.Errorf("client.Get(%q) = %v, want %v", key, err, ErrNotFound)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stats := client.PoolStats(); stats.Dials != 2 || stats.InUse != 2 {
+		t.Errorf("client.PoolStats() = %d dials, %d in use, want 2, 2", stats.Dials, stats.InUse)
+	}
+}
+
+func TestMultiplexedClosed(t *testing.T) {
+	host, port := serveMeta(t)
+
+	client, err := Connect(host, WithPort(port), WithMultiplexedConns(1))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	client.Close()
+
+	if _, err := client.Get(context.Background(), "key"); err == nil {
+		t.Errorf("client.Get() after close = %v, want error", err)
+	}
+}
+
+func TestMultiplexedClientError(t *testing.T) {
+	host, port := serveMeta(t)
+
+	client, err := Connect(host, WithPort(port), WithMultiplexedConns(1))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "key", "value", 0); err != nil {
+		t.Fatalf("client.Set() = %v, want %v", err, nil)
+	}
+	if _, err := client.Get(ctx, "bad"); err == nil {
+		t.Errorf("client.Get(%q) = %v, want error", "bad", err)
+	}
+	if got, err := client.Get(ctx, "key"); got != "value" || err != nil {
+		t.Errorf("client.Get(%q) = %q, %v, want %q, %v", "key", got, err, "value", nil)
+	}
+
+	if stats := client.PoolStats(); stats.Dials != 1 {
+		t.Errorf("client.PoolStats().Dials = %d, want 1, the session must survive a client error", stats.Dials)
+	}
+}
+
+func TestMultiplexedCircuitBreaker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	addr := lis.Addr().(*net.TCPAddr)
+	lis.Close()
+
+	client, err := Connect(addr.IP.String(), WithPort(addr.Port), WithMultiplexedConns(1), WithCircuitBreaker(0.5, 2, time.Minute))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get(ctx, "key"); err == nil || err == ErrCircuitOpen {
+			t.Errorf("client.Get() = %v, want dial error", err)
+		}
+	}
+	if _, err := client.Get(ctx, "key"); err != ErrCircuitOpen {
+		t.Errorf("client.Get() = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	if stats := client.PoolStats(); stats.DialErrors != 2 || stats.BreakerRejected != 1 {
+		t.Errorf("client.PoolStats() = %d dial errors, %d rejected, want 2, 1", stats.DialErrors, stats.BreakerRejected)
+	}
+}
+
+func TestMultiplexedShutdown(t *testing.T) {
+	host, port := serveMeta(t)
+
+	client, err := Connect(host, WithPort(port), WithMultiplexedConns(1))
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+
+	ctx := context.Background()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Get(ctx, "slow")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	if err := client.Shutdown(shutdownCtx); err != nil {
+		t.Errorf("client.Shutdown() = %v, want %v", err, nil)
+	}
+	if err := <-done; err != ErrNotFound {
+		t.Errorf("client.Get() in flight = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := client.Get(ctx, "key"); err == nil {
+		t.Errorf("client.Get() after shutdown = %v, want error", err)
+	}
+	if stats := client.PoolStats(); stats.OpenConns != 0 {
+		t.Errorf("client.PoolStats().OpenConns = %d, want 0", stats.OpenConns)
+	}
+}
+
+func TestMultiplexedConnsLimit(t *testing.T) {
+	if _, err := Connect("127.0.0.1", WithMaxOpenConns(2), WithMultiplexedConns(2)); err != ErrMuxConns {
+		t.Errorf("Connect() = %v, want %v", err, ErrMuxConns)
+	}
+}
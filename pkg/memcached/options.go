@@ -1,6 +1,10 @@
 package memcached
 
-import "time"
+import (
+	"context"
+	"github.com/swanden/storage/pkg/pool"
+	"time"
+)
 
 type Option func(*Client)
 
@@ -16,6 +20,21 @@ func WithMaxIdleConns(maxIdleConns int) Option {
 	}
 }
 
+// WithMinIdleConns sets how many idle connections the pool keeps open in background
+func WithMinIdleConns(minIdleConns int) Option {
+	return func(c *Client) {
+		c.minIdleConns = minIdleConns
+	}
+}
+
+// WithWarmup makes Connect open min idle connections, or one connection if min idle is 0,
+// and fail if the server is unreachable within ctx
+func WithWarmup(ctx context.Context) Option {
+	return func(c *Client) {
+		c.warmupCtx = ctx
+	}
+}
+
 func WithMaxOpenConns(maxOpenConns int) Option {
 	return func(c *Client) {
 		c.maxOpenConns = maxOpenConns
@@ -33,3 +52,82 @@ func WithConnRetryTimeout(connRetryTimeout time.Duration) Option {
 		c.connRetryTimeout = connRetryTimeout
 	}
 }
+
+// WithMaxIdleTime sets how long a connection may stay idle in the pool,
+// if 0 - idle connections are not closed by time
+func WithMaxIdleTime(maxIdleTime time.Duration) Option {
+	return func(c *Client) {
+		c.maxIdleTime = maxIdleTime
+	}
+}
+
+// WithMaxConnLifetime sets how long a connection may be reused since it was opened,
+// if 0 - connections are reused forever
+func WithMaxConnLifetime(maxConnLifetime time.Duration) Option {
+	return func(c *Client) {
+		c.maxConnLifetime = maxConnLifetime
+	}
+}
+
+// WithHealthCheckIdleThreshold sets how long a connection may stay unchecked
+// before it is verified with version command on borrow, if 0 - no check on borrow
+func WithHealthCheckIdleThreshold(healthCheckIdleThreshold time.Duration) Option {
+	return func(c *Client) {
+		c.healthCheckIdleThreshold = healthCheckIdleThreshold
+	}
+}
+
+// WithKeepaliveInterval sets how often idle connections are checked in background,
+// if 0 - keepalive is disabled
+func WithKeepaliveInterval(keepaliveInterval time.Duration) Option {
+	return func(c *Client) {
+		c.keepaliveInterval = keepaliveInterval
+	}
+}
+
+// WithMaxWaiters sets how many requests may wait for a pool connection,
+// if 0 - the wait queue is unbounded
+func WithMaxWaiters(maxWaiters int) Option {
+	return func(c *Client) {
+		c.maxWaiters = maxWaiters
+	}
+}
+
+// WithCircuitBreaker enables circuit breaker which opens when the ratio of failed dials
+// and connection reads and writes within window reaches failureRatio,
+// at least minRequests are needed to open it, zero values keep pool defaults
+func WithCircuitBreaker(failureRatio float64, minRequests int, window time.Duration) Option {
+	return func(c *Client) {
+		c.breakerFailureRatio = failureRatio
+		c.breakerMinRequests = minRequests
+		c.breakerWindow = window
+	}
+}
+
+// WithCircuitBreakerRecovery sets how long the open breaker fails requests with ErrCircuitOpen
+// and how many trial requests must succeed to close it, zero values keep pool defaults
+func WithCircuitBreakerRecovery(openTimeout time.Duration, halfOpenRequests int) Option {
+	return func(c *Client) {
+		c.breakerOpenTimeout = openTimeout
+		c.breakerHalfOpenRequests = halfOpenRequests
+	}
+}
+
+// WithCircuitBreakerStateHook sets a function called on every breaker state change
+func WithCircuitBreakerStateHook(hook pool.BreakerStateHook) Option {
+	return func(c *Client) {
+		c.breakerStateHook = hook
+	}
+}
+
+// WithMultiplexedConns makes Set, Get and Delete share n connections using meta protocol
+// commands tagged with opaque tokens instead of taking a pool connection per request,
+// other commands still use the pool, if 0 - multiplexing is disabled.
+// The shared connections are borrowed from the pool for their lifetime, so they count
+// against max open connections and are dialed through the circuit breaker,
+// Connect fails when they leave no connections for other commands
+func WithMultiplexedConns(n int) Option {
+	return func(c *Client) {
+		c.multiplexedConns = n
+	}
+}
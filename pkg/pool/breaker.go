@@ -0,0 +1,179 @@
+package pool
+
+import "time"
+
+const (
+	defaultBreakerMinRequests      = 10
+	defaultBreakerWindow           = 10 * time.Second
+	defaultBreakerOpenTimeout      = 5 * time.Second
+	defaultBreakerHalfOpenRequests = 1
+)
+
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through and counts their failures
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all requests with ErrCircuitOpen until open timeout expires
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of trial requests through,
+	// their results decide whether the breaker closes or opens again
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerStateHook is called on every breaker state change,
+// it runs in its own goroutine and must not block the pool
+type BreakerStateHook func(from, to BreakerState)
+
+// breaker is a circuit breaker driven by resource failures,
+// it is guarded by the pool mutex
+type breaker struct {
+	failureRatio     float64
+	minRequests      int
+	window           time.Duration
+	openTimeout      time.Duration
+	halfOpenRequests int
+	onStateChange    BreakerStateHook
+
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trials      int
+	successes   int
+
+	opens    uint64
+	rejected uint64
+}
+
+func (b *breaker) enabled() bool {
+	return b.failureRatio > 0
+}
+
+// allow reports whether a request may go through and whether it is a trial one
+func (b *breaker) allow(now time.Time) (bool, error) {
+	if !b.enabled() {
+		return false, nil
+	}
+
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.openTimeout {
+		b.setState(BreakerHalfOpen, now)
+	}
+
+	switch b.state {
+	case BreakerOpen:
+		b.rejected++
+		return false, ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.trials >= b.halfOpenRequests {
+			b.rejected++
+			return false, ErrCircuitOpen
+		}
+		b.trials++
+
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// abort gives back a trial slot of a request which ended without a result
+func (b *breaker) abort(trial bool) {
+	if trial && b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+}
+
+// isTrial reports whether the resource borrowed in the half-open state after open number opened
+// is a trial of the current half-open state, resources borrowed before the breaker opened aren't
+func (b *breaker) isTrial(opened uint64) bool {
+	return opened != 0 && b.state == BreakerHalfOpen && opened == b.opens
+}
+
+// success counts a successful request, in the half-open state only trial requests are counted
+func (b *breaker) success(now time.Time, trial bool) {
+	if !b.enabled() {
+		return
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if !trial {
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.halfOpenRequests {
+			b.setState(BreakerClosed, now)
+		}
+	case BreakerClosed:
+		b.count(now, false)
+	}
+}
+
+// failure counts a failed request, in the half-open state only trial requests are counted
+func (b *breaker) failure(now time.Time, trial bool) {
+	if !b.enabled() {
+		return
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if !trial {
+			return
+		}
+
+		b.setState(BreakerOpen, now)
+	case BreakerClosed:
+		b.count(now, true)
+
+		if b.requests >= b.minRequests && float64(b.failures)/float64(b.requests) >= b.failureRatio {
+			b.setState(BreakerOpen, now)
+		}
+	}
+}
+
+// count adds request result to the current window, the window starts over when it expires
+func (b *breaker) count(now time.Time, failed bool) {
+	if now.Sub(b.windowStart) >= b.window {
+		b.windowStart = now
+		b.requests, b.failures = 0, 0
+	}
+
+	b.requests++
+	if failed {
+		b.failures++
+	}
+}
+
+func (b *breaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+
+	b.state = state
+	b.windowStart = now
+	b.requests, b.failures = 0, 0
+	b.trials, b.successes = 0, 0
+
+	if state == BreakerOpen {
+		b.openedAt = now
+		b.opens++
+	}
+
+	if b.onStateChange != nil {
+		go b.onStateChange(from, state)
+	}
+}
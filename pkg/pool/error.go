@@ -0,0 +1,15 @@
+package pool
+
+import "github.com/pkg/errors"
+
+var (
+	ErrDial           = errors.New("pool: unable to open resource")
+	ErrConnTimeout    = errors.New("pool: resource request timeout")
+	ErrConnCanceled   = errors.New("pool: resource request canceled")
+	ErrUnexpectedData = errors.New("pool: unexpected data on idle connection")
+	ErrPoolExhausted  = errors.New("pool: too many requests waiting for resource")
+	ErrWarmup         = errors.New("pool: unable to warm up resources")
+	ErrPoolClosed     = errors.New("pool: pool is closed")
+	ErrShutdown       = errors.New("pool: borrowed resources were force-closed on shutdown")
+	ErrCircuitOpen    = errors.New("pool: circuit breaker is open")
+)
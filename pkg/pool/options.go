@@ -0,0 +1,168 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+type Option func(*options)
+
+type options struct {
+	maxOpenConns             int
+	maxIdleConns             int
+	minIdleConns             int
+	maxWaiters               int
+	newConnTimeout           time.Duration
+	connRetryTimeout         time.Duration
+	maxIdleTime              time.Duration
+	maxConnLifetime          time.Duration
+	healthCheckIdleThreshold time.Duration
+	keepaliveInterval        time.Duration
+	warmupCtx                context.Context
+	breakerFailureRatio      float64
+	breakerMinRequests       int
+	breakerWindow            time.Duration
+	breakerOpenTimeout       time.Duration
+	breakerHalfOpenRequests  int
+	breakerStateHook         BreakerStateHook
+}
+
+func getDefaultOptions() options {
+	return options{
+		maxWaiters:              defaultMaxWaiters,
+		breakerMinRequests:      defaultBreakerMinRequests,
+		breakerWindow:           defaultBreakerWindow,
+		breakerOpenTimeout:      defaultBreakerOpenTimeout,
+		breakerHalfOpenRequests: defaultBreakerHalfOpenRequests,
+	}
+}
+
+func WithMaxIdleConns(maxIdleConns int) Option {
+	return func(o *options) {
+		o.maxIdleConns = maxIdleConns
+	}
+}
+
+// WithMaxOpenConns sets max open resources, if 0 - unlimited
+func WithMaxOpenConns(maxOpenConns int) Option {
+	return func(o *options) {
+		o.maxOpenConns = maxOpenConns
+	}
+}
+
+// WithMinIdleConns sets how many idle resources the pool keeps open in background
+func WithMinIdleConns(minIdleConns int) Option {
+	return func(o *options) {
+		o.minIdleConns = minIdleConns
+	}
+}
+
+// WithWarmup makes New open min idle resources, or one resource if min idle is 0,
+// and fail if they can't be opened within ctx
+func WithWarmup(ctx context.Context) Option {
+	return func(o *options) {
+		o.warmupCtx = ctx
+	}
+}
+
+// WithMaxWaiters sets how many requests may wait for a resource,
+// others fail with ErrPoolExhausted, if 0 - the wait queue is unbounded
+func WithMaxWaiters(maxWaiters int) Option {
+	return func(o *options) {
+		o.maxWaiters = maxWaiters
+	}
+}
+
+// WithNewConnTimeout bounds dial and validation duration, if 0 - only by the caller context
+func WithNewConnTimeout(newConnTimeout time.Duration) Option {
+	return func(o *options) {
+		o.newConnTimeout = newConnTimeout
+	}
+}
+
+// WithConnRetryTimeout sets how long a request may wait for a resource,
+// if 0 - the request waits until its context is done
+func WithConnRetryTimeout(connRetryTimeout time.Duration) Option {
+	return func(o *options) {
+		o.connRetryTimeout = connRetryTimeout
+	}
+}
+
+// WithMaxIdleTime sets how long a resource may stay idle before it is closed,
+// if 0 - idle resources are not closed by time
+func WithMaxIdleTime(maxIdleTime time.Duration) Option {
+	return func(o *options) {
+		o.maxIdleTime = maxIdleTime
+	}
+}
+
+// WithMaxConnLifetime sets how long a resource may be reused since it was opened,
+// if 0 - resources are reused forever
+func WithMaxConnLifetime(maxConnLifetime time.Duration) Option {
+	return func(o *options) {
+		o.maxConnLifetime = maxConnLifetime
+	}
+}
+
+// WithHealthCheckIdleThreshold sets how long a resource may stay unchecked
+// before it is validated on borrow, if 0 - resources are not validated on borrow
+func WithHealthCheckIdleThreshold(healthCheckIdleThreshold time.Duration) Option {
+	return func(o *options) {
+		o.healthCheckIdleThreshold = healthCheckIdleThreshold
+	}
+}
+
+// WithKeepaliveInterval sets how often idle resources are validated in background,
+// if 0 - keepalive is disabled
+func WithKeepaliveInterval(keepaliveInterval time.Duration) Option {
+	return func(o *options) {
+		o.keepaliveInterval = keepaliveInterval
+	}
+}
+
+// WithBreakerFailureRatio enables circuit breaker which opens when the ratio of failed
+// requests within a window reaches the value, if 0 - circuit breaker is disabled.
+// Dial errors and resources passed to Discard are failures, resources returned with Put are successes
+func WithBreakerFailureRatio(failureRatio float64) Option {
+	return func(o *options) {
+		o.breakerFailureRatio = failureRatio
+	}
+}
+
+// WithBreakerMinRequests sets how many requests within a window are needed
+// before the failure ratio is taken into account
+func WithBreakerMinRequests(minRequests int) Option {
+	return func(o *options) {
+		o.breakerMinRequests = minRequests
+	}
+}
+
+// WithBreakerWindow sets duration of the window the failure ratio is counted in
+func WithBreakerWindow(window time.Duration) Option {
+	return func(o *options) {
+		o.breakerWindow = window
+	}
+}
+
+// WithBreakerOpenTimeout sets how long the open breaker rejects requests
+// before it lets trial ones through
+func WithBreakerOpenTimeout(openTimeout time.Duration) Option {
+	return func(o *options) {
+		o.breakerOpenTimeout = openTimeout
+	}
+}
+
+// WithBreakerHalfOpenRequests sets how many trial requests the half-open breaker lets through,
+// the breaker closes when all of them succeed and opens again on the first failure
+func WithBreakerHalfOpenRequests(halfOpenRequests int) Option {
+	return func(o *options) {
+		o.breakerHalfOpenRequests = halfOpenRequests
+	}
+}
+
+// WithBreakerStateHook sets a function called on every breaker state change
+func WithBreakerStateHook(hook BreakerStateHook) Option {
+	return func(o *options) {
+		o.breakerStateHook = hook
+	}
+}
@@ -0,0 +1,852 @@
+// Package pool is a generic pool of resources like network connections
+package pool
+
+import (
+	"container/list"
+	"context"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxWaiters = 10_000
+	minReapInterval   = time.Second
+	maintainInterval  = time.Second
+	readProbeTimeout  = time.Millisecond
+)
+
+// Dialer opens new resources for the pool
+type Dialer[T io.Closer] interface {
+	Dial(ctx context.Context) (T, error)
+}
+
+// Validator is an optional interface of Dialer, when implemented the pool
+// validates resources on borrow and in keepalive, ctx bounds the check duration
+type Validator[T io.Closer] interface {
+	Validate(ctx context.Context, resource T) error
+}
+
+// DialerFunc adapts a function to Dialer
+type DialerFunc[T io.Closer] func(ctx context.Context) (T, error)
+
+func (f DialerFunc[T]) Dial(ctx context.Context) (T, error) {
+	return f(ctx)
+}
+
+// ReadProbe checks that a network connection is not closed by the server,
+// an idle connection must have nothing to read
+func ReadProbe(_ context.Context, c net.Conn) error {
+	if err := c.SetReadDeadline(time.Now().Add(readProbeTimeout)); err != nil {
+		return err
+	}
+	defer c.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := c.Read(b[:])
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	if err == nil {
+		return ErrUnexpectedData
+	}
+
+	return err
+}
+
+// Resource is a value borrowed from the pool, it must be returned with Put
+type Resource[T io.Closer] struct {
+	value      T
+	createdAt  time.Time
+	returnedAt time.Time
+	checkedAt  time.Time
+	// trial is the open number of the breaker the resource is borrowed as a half-open trial after,
+	// it's 0 for other resources
+	trial uint64
+}
+
+func (r *Resource[T]) Value() T {
+	return r.value
+}
+
+// waiter is a Get call waiting for a resource,
+// it receives either a resource or a reserved slot to open a new one
+type waiter[T io.Closer] struct {
+	ready chan response[T]
+}
+
+type response[T io.Closer] struct {
+	resource *Resource[T]
+	err      error
+}
+
+type Pool[T io.Closer] struct {
+	dialer    Dialer[T]
+	validator Validator[T]
+
+	mu        sync.Mutex
+	idleConns []*Resource[T]
+	waiters   *list.List
+	resources map[*Resource[T]]struct{}
+
+	openConns    int
+	maxOpenConns int
+	maxIdleConns int
+	minIdleConns int
+	maxWaiters   int
+
+	newConnTimeout   time.Duration
+	connRetryTimeout time.Duration
+	maxIdleTime      time.Duration
+	maxConnLifetime  time.Duration
+
+	healthCheckIdleThreshold time.Duration
+	keepaliveInterval        time.Duration
+
+	counters counters
+	breaker  breaker
+
+	closed  bool
+	done    chan struct{}
+	drained chan struct{}
+}
+
+func New[T io.Closer](dialer Dialer[T], opts ...Option) (*Pool[T], error) {
+	o := getDefaultOptions()
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	pool := &Pool[T]{
+		dialer:                   dialer,
+		waiters:                  list.New(),
+		resources:                make(map[*Resource[T]]struct{}),
+		maxOpenConns:             o.maxOpenConns,
+		maxIdleConns:             o.maxIdleConns,
+		minIdleConns:             o.minIdleConns,
+		maxWaiters:               o.maxWaiters,
+		newConnTimeout:           o.newConnTimeout,
+		connRetryTimeout:         o.connRetryTimeout,
+		maxIdleTime:              o.maxIdleTime,
+		maxConnLifetime:          o.maxConnLifetime,
+		healthCheckIdleThreshold: o.healthCheckIdleThreshold,
+		keepaliveInterval:        o.keepaliveInterval,
+		done:                     make(chan struct{}),
+		drained:                  make(chan struct{}),
+		breaker: breaker{
+			failureRatio:     o.breakerFailureRatio,
+			minRequests:      o.breakerMinRequests,
+			window:           o.breakerWindow,
+			openTimeout:      o.breakerOpenTimeout,
+			halfOpenRequests: o.breakerHalfOpenRequests,
+			onStateChange:    o.breakerStateHook,
+		},
+	}
+
+	if validator, ok := dialer.(Validator[T]); ok {
+		pool.validator = validator
+	}
+
+	pool.idleConns = make([]*Resource[T], 0, pool.maxIdleConns)
+
+	if o.warmupCtx != nil {
+		if err := pool.warmup(o.warmupCtx); err != nil {
+			return nil, errors.Wrap(ErrWarmup, err.Error())
+		}
+	}
+
+	if pool.minIdleConns > 0 {
+		go pool.maintainMinIdle()
+	}
+
+	if pool.maxIdleTime > 0 || pool.maxConnLifetime > 0 {
+		go pool.reapConns()
+	}
+
+	if pool.validator != nil && pool.keepaliveInterval > 0 {
+		go pool.keepalive()
+	}
+
+	return pool, nil
+}
+
+// Put returns resource to the pool, the oldest waiter gets it first,
+// resources over max lifetime or over max idle count are closed,
+// after Close all returned resources are closed
+func (p *Pool[T]) Put(r *Resource[T]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		p.closeConnLocked(r)
+		return
+	}
+
+	now := time.Now()
+	if p.lifetimeExpired(r, now) {
+		p.counters.maxLifetimeClosed++
+		p.breaker.abort(p.breaker.isTrial(r.trial))
+		p.closeConnLocked(r)
+		return
+	}
+
+	r.returnedAt = now
+	r.checkedAt = now
+	p.breaker.success(now, p.breaker.isTrial(r.trial))
+	r.trial = 0
+
+	p.putLocked(r)
+}
+
+// Discard closes resource which failed while in use instead of returning it to the pool,
+// the failure is counted by the circuit breaker
+func (p *Pool[T]) Discard(r *Resource[T]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.breaker.failure(time.Now(), p.breaker.isTrial(r.trial))
+	}
+
+	p.closeConnLocked(r)
+}
+
+// Drop closes resource which can't be reused though it didn't fail, like a connection
+// with the unread rest of a response, it isn't counted by the circuit breaker
+func (p *Pool[T]) Drop(r *Resource[T]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.breaker.abort(p.breaker.isTrial(r.trial))
+	p.closeConnLocked(r)
+}
+
+// Get returns idle resource or opens a new one,
+// idle resources which fail validation are replaced with new ones.
+// After Close it fails with ErrPoolClosed, while the circuit breaker is open - with ErrCircuitOpen
+func (p *Pool[T]) Get(ctx context.Context) (*Resource[T], error) {
+	p.mu.Lock()
+	trial, err := p.breaker.allow(time.Now())
+	opened := p.breaker.opens
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		r, err := p.get(ctx)
+		if err != nil {
+			p.mu.Lock()
+			p.breaker.abort(trial)
+			p.mu.Unlock()
+
+			return nil, err
+		}
+
+		if p.healthy(ctx, r) {
+			if trial {
+				r.trial = opened
+			}
+
+			return r, nil
+		}
+
+		p.discard(r)
+	}
+}
+
+func (p *Pool[T]) get(ctx context.Context) (*Resource[T], error) {
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	if r, ok := p.popIdleConn(); ok {
+		p.mu.Unlock()
+		return r, nil
+	}
+
+	if p.maxOpenConns <= 0 || p.openConns < p.maxOpenConns {
+		p.openConns++
+		p.mu.Unlock()
+
+		return p.dial(ctx)
+	}
+
+	if p.maxWaiters > 0 && p.waiters.Len() >= p.maxWaiters {
+		p.counters.exhausted++
+		p.mu.Unlock()
+
+		return nil, ErrPoolExhausted
+	}
+
+	w := &waiter[T]{ready: make(chan response[T], 1)}
+	elem := p.waiters.PushBack(w)
+	p.counters.waitCount++
+	p.mu.Unlock()
+
+	resp, err := p.wait(ctx, w, elem)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.resource == nil && resp.err == nil {
+		return p.dial(ctx)
+	}
+
+	return resp.resource, resp.err
+}
+
+// wait blocks until the waiter is served or ctx is done or retry timeout expires
+func (p *Pool[T]) wait(ctx context.Context, w *waiter[T], elem *list.Element) (response[T], error) {
+	start := time.Now()
+	defer func() {
+		p.mu.Lock()
+		p.counters.waitDuration += time.Since(start)
+		p.mu.Unlock()
+	}()
+
+	var timeout <-chan time.Time
+	if p.connRetryTimeout > 0 {
+		timer := time.NewTimer(p.connRetryTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+
+	select {
+	case resp := <-w.ready:
+		return resp, nil
+	case <-ctx.Done():
+		err = ErrConnCanceled
+	case <-timeout:
+		err = ErrConnTimeout
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if errors.Is(err, ErrConnCanceled) {
+		p.counters.cancels++
+	} else {
+		p.counters.timeouts++
+	}
+
+	p.waiters.Remove(elem)
+
+	// the waiter could be served right before it was removed from the queue
+	select {
+	case resp := <-w.ready:
+		switch {
+		case resp.resource != nil:
+			p.putLocked(resp.resource)
+		case resp.err == nil:
+			p.releaseSlotLocked()
+		}
+	default:
+	}
+
+	return response[T]{}, err
+}
+
+// putLocked is Put for callers holding p.mu
+func (p *Pool[T]) putLocked(r *Resource[T]) {
+	if p.closed || (p.maxOpenConns > 0 && p.openConns > p.maxOpenConns) {
+		p.closeConnLocked(r)
+		return
+	}
+
+	if w, ok := p.popWaiterLocked(); ok {
+		w.ready <- response[T]{resource: r}
+		return
+	}
+
+	if p.maxIdleConns > len(p.idleConns) {
+		p.idleConns = append(p.idleConns, r)
+		return
+	}
+
+	p.counters.maxIdleClosed++
+	p.closeConnLocked(r)
+}
+
+func (p *Pool[T]) popWaiterLocked() (*waiter[T], bool) {
+	elem := p.waiters.Front()
+	if elem == nil {
+		return nil, false
+	}
+
+	return p.waiters.Remove(elem).(*waiter[T]), true
+}
+
+// serveWaiterLocked gives a free slot to the oldest waiter, p.mu must be held
+func (p *Pool[T]) serveWaiterLocked() {
+	if p.maxOpenConns > 0 && p.openConns >= p.maxOpenConns {
+		return
+	}
+
+	w, ok := p.popWaiterLocked()
+	if !ok {
+		return
+	}
+
+	p.openConns++
+	w.ready <- response[T]{}
+}
+
+// SetMaxOpenConns changes max open resources, if 0 - unlimited.
+// Surplus idle resources are closed at once and in-use ones when they are returned,
+// waiters are served immediately when the limit grows
+func (p *Pool[T]) SetMaxOpenConns(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+
+	p.maxOpenConns = n
+	if n > 0 && p.maxIdleConns > n {
+		p.maxIdleConns = n
+	}
+
+	for len(p.idleConns) > 0 && n > 0 && p.openConns > n {
+		r := p.idleConns[0]
+		p.removeIdleConn(0)
+		p.counters.maxIdleClosed++
+		p.closeConnLocked(r)
+	}
+
+	p.closeSurplusIdleConnsLocked()
+
+	for p.waiters.Len() > 0 && (n == 0 || p.openConns < n) {
+		p.serveWaiterLocked()
+	}
+}
+
+// SetMaxIdleConns changes max idle resources, surplus idle resources are closed
+func (p *Pool[T]) SetMaxIdleConns(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n < 0 {
+		n = 0
+	}
+	if p.maxOpenConns > 0 && n > p.maxOpenConns {
+		n = p.maxOpenConns
+	}
+
+	p.maxIdleConns = n
+	p.closeSurplusIdleConnsLocked()
+}
+
+// closeSurplusIdleConnsLocked closes the oldest idle resources over max idle, p.mu must be held
+func (p *Pool[T]) closeSurplusIdleConnsLocked() {
+	for len(p.idleConns) > p.maxIdleConns {
+		r := p.idleConns[0]
+		p.removeIdleConn(0)
+		p.counters.maxIdleClosed++
+		p.closeConnLocked(r)
+	}
+}
+
+// closeConnLocked closes resource and passes its slot to a waiter,
+// resources already force-closed by Shutdown are skipped, p.mu must be held
+func (p *Pool[T]) closeConnLocked(r *Resource[T]) {
+	if _, ok := p.resources[r]; !ok {
+		return
+	}
+
+	delete(p.resources, r)
+	r.value.Close()
+	p.releaseSlotLocked()
+}
+
+// releaseSlotLocked frees an open resource slot, p.mu must be held
+func (p *Pool[T]) releaseSlotLocked() {
+	p.openConns--
+
+	if p.closed {
+		p.signalDrainedLocked()
+		return
+	}
+
+	p.serveWaiterLocked()
+}
+
+// signalDrainedLocked wakes up Shutdown when the closed pool has no open resources,
+// p.mu must be held
+func (p *Pool[T]) signalDrainedLocked() {
+	if p.openConns > 0 {
+		return
+	}
+
+	select {
+	case <-p.drained:
+	default:
+		close(p.drained)
+	}
+}
+
+// dial opens a resource in already reserved slot,
+// the resource is closed if the pool was closed while dialing
+func (p *Pool[T]) dial(ctx context.Context) (*Resource[T], error) {
+	r, err := p.openNewConnection(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.releaseSlotLocked()
+		return nil, err
+	}
+
+	p.resources[r] = struct{}{}
+
+	if p.closed {
+		p.closeConnLocked(r)
+		return nil, ErrPoolClosed
+	}
+
+	return r, nil
+}
+
+// healthy validates resources idle longer than the threshold,
+// new resources are not checked
+func (p *Pool[T]) healthy(ctx context.Context, r *Resource[T]) bool {
+	if p.validator == nil || p.healthCheckIdleThreshold <= 0 || r.checkedAt.IsZero() {
+		return true
+	}
+
+	if time.Since(r.checkedAt) < p.healthCheckIdleThreshold {
+		return true
+	}
+
+	return p.check(ctx, r)
+}
+
+func (p *Pool[T]) check(ctx context.Context, r *Resource[T]) bool {
+	if p.newConnTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.newConnTimeout)
+		defer cancel()
+	}
+
+	if err := p.validator.Validate(ctx, r.value); err != nil {
+		p.mu.Lock()
+		p.counters.healthCheckFailures++
+		p.mu.Unlock()
+
+		return false
+	}
+	r.checkedAt = time.Now()
+
+	return true
+}
+
+// discard closes resource taken from the pool
+func (p *Pool[T]) discard(r *Resource[T]) {
+	p.mu.Lock()
+	p.closeConnLocked(r)
+	p.mu.Unlock()
+}
+
+func (p *Pool[T]) removeIdleConn(index int) {
+	copy(p.idleConns[index:], p.idleConns[index+1:])
+	p.idleConns[len(p.idleConns)-1] = nil
+	p.idleConns = p.idleConns[:len(p.idleConns)-1]
+}
+
+// popIdleConn takes the first idle resource which is not expired,
+// expired ones are closed on the way, p.mu must be held
+func (p *Pool[T]) popIdleConn() (*Resource[T], bool) {
+	now := time.Now()
+
+	for len(p.idleConns) > 0 {
+		r := p.idleConns[0]
+		p.removeIdleConn(0)
+
+		if p.closeExpired(r, now) {
+			continue
+		}
+
+		return r, true
+	}
+
+	return nil, false
+}
+
+// closeExpired closes resource over max idle time or max lifetime, p.mu must be held
+func (p *Pool[T]) closeExpired(r *Resource[T], now time.Time) bool {
+	switch {
+	case p.lifetimeExpired(r, now):
+		p.counters.maxLifetimeClosed++
+	case p.idleExpired(r, now):
+		p.counters.maxIdleTimeClosed++
+	default:
+		return false
+	}
+
+	p.closeConnLocked(r)
+
+	return true
+}
+
+func (p *Pool[T]) idleExpired(r *Resource[T], now time.Time) bool {
+	return p.maxIdleTime > 0 && now.Sub(r.returnedAt) >= p.maxIdleTime
+}
+
+func (p *Pool[T]) lifetimeExpired(r *Resource[T], now time.Time) bool {
+	return p.maxConnLifetime > 0 && now.Sub(r.createdAt) >= p.maxConnLifetime
+}
+
+// reapConns periodically closes idle resources over max idle time or max lifetime
+func (p *Pool[T]) reapConns() {
+	interval := p.maxIdleTime
+	if interval <= 0 || (p.maxConnLifetime > 0 && p.maxConnLifetime < interval) {
+		interval = p.maxConnLifetime
+	}
+	if interval < minReapInterval {
+		interval = minReapInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.reapExpiredConns()
+		}
+	}
+}
+
+func (p *Pool[T]) reapExpiredConns() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	alive := p.idleConns[:0]
+
+	for _, r := range p.idleConns {
+		if p.closeExpired(r, now) {
+			continue
+		}
+
+		alive = append(alive, r)
+	}
+
+	for i := len(alive); i < len(p.idleConns); i++ {
+		p.idleConns[i] = nil
+	}
+	p.idleConns = alive
+}
+
+// keepalive periodically validates resources idle longer than keepalive interval
+func (p *Pool[T]) keepalive() {
+	ticker := time.NewTicker(p.keepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.checkIdleConns()
+		}
+	}
+}
+
+func (p *Pool[T]) checkIdleConns() {
+	p.mu.Lock()
+
+	now := time.Now()
+	var checking []*Resource[T]
+	idle := p.idleConns[:0]
+
+	for _, r := range p.idleConns {
+		if now.Sub(r.checkedAt) >= p.keepaliveInterval {
+			checking = append(checking, r)
+			continue
+		}
+
+		idle = append(idle, r)
+	}
+
+	for i := len(idle); i < len(p.idleConns); i++ {
+		p.idleConns[i] = nil
+	}
+	p.idleConns = idle
+
+	p.mu.Unlock()
+
+	for _, r := range checking {
+		if !p.check(context.Background(), r) {
+			p.discard(r)
+			continue
+		}
+
+		p.mu.Lock()
+		p.putLocked(r)
+		p.mu.Unlock()
+	}
+}
+
+// warmup opens min idle resources or one resource to check the server is reachable
+func (p *Pool[T]) warmup(ctx context.Context) error {
+	n := p.minIdleConns
+	if n == 0 {
+		n = 1
+	}
+	if p.maxOpenConns > 0 && n > p.maxOpenConns {
+		n = p.maxOpenConns
+	}
+
+	resources := make([]*Resource[T], 0, n)
+	for i := 0; i < n; i++ {
+		r, err := p.openNewConnection(ctx)
+		if err != nil {
+			for _, r := range resources {
+				r.value.Close()
+			}
+
+			return err
+		}
+
+		resources = append(resources, r)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for _, r := range resources {
+		p.openConns++
+		p.resources[r] = struct{}{}
+		r.returnedAt = now
+		r.checkedAt = now
+		p.putLocked(r)
+	}
+
+	return nil
+}
+
+// maintainMinIdle periodically opens resources until there are min idle ones
+func (p *Pool[T]) maintainMinIdle() {
+	ticker := time.NewTicker(maintainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.openMinIdleConns()
+		}
+	}
+}
+
+func (p *Pool[T]) openMinIdleConns() {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.idleConns) >= p.minIdleConns || len(p.idleConns) >= p.maxIdleConns ||
+			(p.maxOpenConns > 0 && p.openConns >= p.maxOpenConns) {
+			p.mu.Unlock()
+			return
+		}
+		p.openConns++
+		p.mu.Unlock()
+
+		r, err := p.dial(context.Background())
+		if err != nil {
+			return
+		}
+
+		p.Put(r)
+	}
+}
+
+func (p *Pool[T]) openNewConnection(ctx context.Context) (*Resource[T], error) {
+	if p.newConnTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.newConnTimeout)
+		defer cancel()
+	}
+
+	value, err := p.dialer.Dial(ctx)
+
+	p.mu.Lock()
+	p.counters.dials++
+	if err != nil {
+		p.counters.dialErrors++
+		p.breaker.failure(time.Now(), true)
+	}
+	p.mu.Unlock()
+
+	if err != nil {
+		return nil, errors.Wrap(ErrDial, err.Error())
+	}
+
+	return &Resource[T]{value: value, createdAt: time.Now()}, nil
+}
+
+// Close closes idle resources and fails waiting requests with ErrPoolClosed,
+// borrowed resources are closed when they are returned
+func (p *Pool[T]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	p.closed = true
+	close(p.done)
+
+	for w, ok := p.popWaiterLocked(); ok; w, ok = p.popWaiterLocked() {
+		w.ready <- response[T]{err: ErrPoolClosed}
+	}
+
+	idle := p.idleConns
+	p.idleConns = nil
+	for _, r := range idle {
+		p.closeConnLocked(r)
+	}
+
+	p.signalDrainedLocked()
+}
+
+// Shutdown closes the pool and waits for borrowed resources to be returned,
+// when ctx is done the remaining resources are force-closed
+func (p *Pool[T]) Shutdown(ctx context.Context) error {
+	p.Close()
+
+	select {
+	case <-p.drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for r := range p.resources {
+		delete(p.resources, r)
+		r.value.Close()
+		p.openConns--
+	}
+	p.signalDrainedLocked()
+
+	return errors.Wrap(ErrShutdown, ctx.Err().Error())
+}
@@ -0,0 +1,700 @@
+package pool
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	maxIdleConns = 10
+	maxOpenConns = 10
+)
+
+type testDialer struct {
+	addr     string
+	validate func(ctx context.Context, c net.Conn) error
+}
+
+func (d *testDialer) Dial(ctx context.Context) (net.Conn, error) {
+	var nd net.Dialer
+
+	return nd.DialContext(ctx, "tcp", d.addr)
+}
+
+func (d *testDialer) Validate(ctx context.Context, c net.Conn) error {
+	if d.validate == nil {
+		return nil
+	}
+
+	return d.validate(ctx, c)
+}
+
+// listen starts tcp server which accepts connections and keeps them open
+func listen(t *testing.T) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() {
+		lis.Close()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+
+		for {
+			c, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, c)
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+func newTestPool(t *testing.T, opts ...Option) *Pool[net.Conn] {
+	t.Helper()
+
+	return newValidatedTestPool(t, nil, opts...)
+}
+
+func newValidatedTestPool(t *testing.T, validate func(ctx context.Context, c net.Conn) error, opts ...Option) *Pool[net.Conn] {
+	t.Helper()
+
+	d := &testDialer{addr: listen(t), validate: validate}
+
+	opts = append([]Option{
+		WithMaxIdleConns(maxIdleConns),
+		WithMaxOpenConns(maxOpenConns),
+		WithNewConnTimeout(time.Second),
+		WithConnRetryTimeout(time.Second),
+	}, opts...)
+
+	p, err := New[net.Conn](d, opts...)
+	if err != nil {
+		t.Fatalf("unable to create pool: %v", err)
+	}
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func TestReuse(t *testing.T) {
+	p := newTestPool(t)
+	ctx := context.Background()
+
+	first, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	p.Put(first)
+
+	second, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	defer p.Put(second)
+
+	if first != second {
+		t.Errorf("p.Get() returned new connection, want idle one")
+	}
+}
+
+func TestMaxIdleTime(t *testing.T) {
+	const maxIdleTime = 50 * time.Millisecond
+
+	p := newTestPool(t, WithMaxIdleTime(maxIdleTime))
+	ctx := context.Background()
+
+	first, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	p.Put(first)
+
+	time.Sleep(2 * maxIdleTime)
+
+	second, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	defer p.Put(second)
+
+	if first == second {
+		t.Errorf("p.Get() returned connection idle for %v, want new one", 2*maxIdleTime)
+	}
+	if p.openConns != 1 {
+		t.Errorf("p.openConns = %d, want %d", p.openConns, 1)
+	}
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	const maxConnLifetime = 50 * time.Millisecond
+
+	p := newTestPool(t, WithMaxConnLifetime(maxConnLifetime))
+	ctx := context.Background()
+
+	first, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+
+	time.Sleep(2 * maxConnLifetime)
+	p.Put(first)
+
+	if len(p.idleConns) != 0 {
+		t.Errorf("len(p.idleConns) = %d, want %d", len(p.idleConns), 0)
+	}
+
+	second, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	defer p.Put(second)
+
+	if first == second {
+		t.Errorf("p.Get() returned connection older than %v, want new one", maxConnLifetime)
+	}
+}
+
+func TestReapConns(t *testing.T) {
+	p := newTestPool(t, WithMaxIdleTime(time.Millisecond))
+	ctx := context.Background()
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	p.Put(c)
+
+	time.Sleep(minReapInterval + 100*time.Millisecond)
+
+	p.mu.Lock()
+	idle, open := len(p.idleConns), p.openConns
+	p.mu.Unlock()
+
+	if idle != 0 || open != 0 {
+		t.Errorf("idle, open = %d, %d, want %d, %d", idle, open, 0, 0)
+	}
+}
+
+func TestHealthCheckOnBorrow(t *testing.T) {
+	failingCheck := func(ctx context.Context, c net.Conn) error {
+		return ErrUnexpectedData
+	}
+
+	p := newValidatedTestPool(t, failingCheck, WithHealthCheckIdleThreshold(time.Millisecond))
+	ctx := context.Background()
+
+	first, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	p.Put(first)
+
+	time.Sleep(10 * time.Millisecond)
+
+	second, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	defer p.Put(second)
+
+	if first == second {
+		t.Errorf("p.Get() returned connection which failed health check, want new one")
+	}
+	if p.openConns != 1 {
+		t.Errorf("p.openConns = %d, want %d", p.openConns, 1)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	const keepaliveInterval = 50 * time.Millisecond
+
+	failingCheck := func(ctx context.Context, c net.Conn) error {
+		return ErrUnexpectedData
+	}
+
+	p := newValidatedTestPool(t, failingCheck, WithKeepaliveInterval(keepaliveInterval))
+	ctx := context.Background()
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	p.Put(c)
+
+	time.Sleep(3 * keepaliveInterval)
+
+	p.mu.Lock()
+	idle, open := len(p.idleConns), p.openConns
+	p.mu.Unlock()
+
+	if idle != 0 || open != 0 {
+		t.Errorf("idle, open = %d, %d, want %d, %d", idle, open, 0, 0)
+	}
+}
+
+func TestReadProbe(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	if err := ReadProbe(context.Background(), client); err != nil {
+		t.Errorf("ReadProbe() = %v, want %v", err, nil)
+	}
+
+	server.Close()
+
+	if err := ReadProbe(context.Background(), client); err == nil {
+		t.Errorf("ReadProbe() on closed connection = %v, want error", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	p := newTestPool(t, WithMaxConnLifetime(50*time.Millisecond))
+	ctx := context.Background()
+
+	first, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	second, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	p.Put(first)
+
+	stats := p.Stats()
+	if stats.OpenConns != 2 || stats.InUse != 1 || stats.Idle != 1 || stats.Dials != 2 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 2, InUse: 1, Idle: 1, Dials: 2", stats)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	p.Put(second)
+
+	stats = p.Stats()
+	if stats.OpenConns != 1 || stats.InUse != 0 || stats.MaxLifetimeClosed != 1 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 1, InUse: 0, MaxLifetimeClosed: 1", stats)
+	}
+}
+
+// waitForWaiters blocks until the pool has n waiting requests
+func waitForWaiters(t *testing.T, p *Pool[net.Conn], n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Waiters != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("p.Stats().Waiters = %d, want %d", p.Stats().Waiters, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWaitQueueOrder(t *testing.T) {
+	p := newTestPool(t, WithMaxOpenConns(1))
+	ctx := context.Background()
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+
+	const waiters = 3
+	order := make(chan int, waiters)
+
+	for i := 0; i < waiters; i++ {
+		go func(i int) {
+			c, err := p.Get(ctx)
+			if err != nil {
+				t.Errorf("p.Get() = %v, want %v", err, nil)
+				return
+			}
+			order <- i
+			p.Put(c)
+		}(i)
+
+		waitForWaiters(t, p, i+1)
+	}
+
+	p.Put(c)
+
+	for i := 0; i < waiters; i++ {
+		if got := <-order; got != i {
+			t.Errorf("waiter %d got connection, want %d", got, i)
+		}
+	}
+}
+
+func TestPoolExhausted(t *testing.T) {
+	p := newTestPool(t, WithMaxOpenConns(1), WithMaxWaiters(1))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	defer p.Put(c)
+
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := p.Get(ctx)
+		canceled <- err
+	}()
+	waitForWaiters(t, p, 1)
+
+	if _, err := p.Get(ctx); err != ErrPoolExhausted {
+		t.Errorf("p.Get() = %v, want %v", err, ErrPoolExhausted)
+	}
+
+	cancel()
+
+	if err := <-canceled; err != ErrConnCanceled {
+		t.Errorf("p.Get() = %v, want %v", err, ErrConnCanceled)
+	}
+	if stats := p.Stats(); stats.Waiters != 0 || stats.Exhausted != 1 || stats.Cancels != 1 {
+		t.Errorf("p.Stats() = %+v, want Waiters: 0, Exhausted: 1, Cancels: 1", stats)
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	p := newTestPool(t, WithMaxOpenConns(1), WithConnRetryTimeout(50*time.Millisecond))
+	ctx := context.Background()
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+	defer p.Put(c)
+
+	if _, err := p.Get(ctx); err != ErrConnTimeout {
+		t.Errorf("p.Get() = %v, want %v", err, ErrConnTimeout)
+	}
+	if stats := p.Stats(); stats.Waiters != 0 || stats.Timeouts != 1 || stats.OpenConns != 1 {
+		t.Errorf("p.Stats() = %+v, want Waiters: 0, Timeouts: 1, OpenConns: 1", stats)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	const minIdleConns = 3
+
+	p := newTestPool(t, WithMinIdleConns(minIdleConns), WithWarmup(context.Background()))
+
+	if stats := p.Stats(); stats.Idle != minIdleConns || stats.Dials != minIdleConns {
+		t.Errorf("p.Stats() = %+v, want Idle: %d, Dials: %d", stats, minIdleConns, minIdleConns)
+	}
+}
+
+func TestWarmupUnreachable(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	d := &testDialer{addr: lis.Addr().String()}
+	lis.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := New[net.Conn](d, WithWarmup(ctx)); !errors.Is(err, ErrWarmup) {
+		t.Errorf("New() = %v, want %v", err, ErrWarmup)
+	}
+}
+
+func TestMinIdleConns(t *testing.T) {
+	const minIdleConns = 2
+
+	p := newTestPool(t, WithMinIdleConns(minIdleConns))
+
+	time.Sleep(maintainInterval + 100*time.Millisecond)
+
+	if stats := p.Stats(); stats.Idle != minIdleConns {
+		t.Errorf("p.Stats().Idle = %d, want %d", stats.Idle, minIdleConns)
+	}
+}
+
+func TestSetMaxOpenConns(t *testing.T) {
+	p := newTestPool(t, WithMaxOpenConns(1))
+	ctx := context.Background()
+
+	first, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+
+	got := make(chan *Resource[net.Conn], 1)
+	go func() {
+		c, err := p.Get(ctx)
+		if err != nil {
+			t.Errorf("p.Get() = %v, want %v", err, nil)
+		}
+		got <- c
+	}()
+	waitForWaiters(t, p, 1)
+
+	p.SetMaxOpenConns(2)
+
+	second := <-got
+	if second == nil {
+		t.Fatalf("waiter didn't get connection after p.SetMaxOpenConns(2)")
+	}
+
+	p.SetMaxOpenConns(1)
+	p.Put(first)
+	p.Put(second)
+
+	if stats := p.Stats(); stats.OpenConns != 1 || stats.Idle != 1 || stats.MaxOpenConns != 1 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 1, Idle: 1, MaxOpenConns: 1", stats)
+	}
+}
+
+func TestSetMaxIdleConns(t *testing.T) {
+	p := newTestPool(t)
+	ctx := context.Background()
+
+	conns := make([]*Resource[net.Conn], 0, 3)
+	for i := 0; i < cap(conns); i++ {
+		c, err := p.Get(ctx)
+		if err != nil {
+			t.Fatalf("p.Get() = %v, want %v", err, nil)
+		}
+		conns = append(conns, c)
+	}
+	for _, c := range conns {
+		p.Put(c)
+	}
+
+	p.SetMaxIdleConns(1)
+
+	if stats := p.Stats(); stats.OpenConns != 1 || stats.Idle != 1 || stats.MaxIdleClosed != 2 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 1, Idle: 1, MaxIdleClosed: 2", stats)
+	}
+}
+
+func TestGetAfterClose(t *testing.T) {
+	p := newTestPool(t, WithMaxOpenConns(1))
+	ctx := context.Background()
+
+	c, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := p.Get(ctx)
+		waiting <- err
+	}()
+	waitForWaiters(t, p, 1)
+
+	p.Close()
+	p.Close()
+
+	if err := <-waiting; err != ErrPoolClosed {
+		t.Errorf("waiting p.Get() = %v, want %v", err, ErrPoolClosed)
+	}
+	if _, err := p.Get(ctx); err != ErrPoolClosed {
+		t.Errorf("p.Get() = %v, want %v", err, ErrPoolClosed)
+	}
+
+	p.Put(c)
+
+	if stats := p.Stats(); stats.OpenConns != 0 || stats.Idle != 0 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 0, Idle: 0", stats)
+	}
+	if _, err := c.Value().Write([]byte("x")); err == nil {
+		t.Errorf("connection returned after close is not closed")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	p := newTestPool(t)
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		p.Put(c)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); err != nil {
+		t.Errorf("p.Shutdown() = %v, want %v", err, nil)
+	}
+	if stats := p.Stats(); stats.OpenConns != 0 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 0", stats)
+	}
+}
+
+func TestShutdownForceClose(t *testing.T) {
+	p := newTestPool(t)
+
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatalf("p.Get() = %v, want %v", err, nil)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := p.Shutdown(ctx); !errors.Is(err, ErrShutdown) {
+		t.Errorf("p.Shutdown() = %v, want %v", err, ErrShutdown)
+	}
+	if _, err := c.Value().Write([]byte("x")); err == nil {
+		t.Errorf("borrowed connection is not closed by shutdown")
+	}
+
+	p.Put(c)
+
+	if stats := p.Stats(); stats.OpenConns != 0 {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 0", stats)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	addr := listen(t)
+	var down atomic.Bool
+	down.Store(true)
+
+	dialer := DialerFunc[net.Conn](func(ctx context.Context) (net.Conn, error) {
+		if down.Load() {
+			return nil, errors.New("connection refused")
+		}
+
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	})
+
+	p, err := New[net.Conn](
+		dialer,
+		WithMaxOpenConns(maxOpenConns),
+		WithMaxIdleConns(maxIdleConns),
+		WithBreakerFailureRatio(0.5),
+		WithBreakerMinRequests(2),
+		WithBreakerOpenTimeout(50*time.Millisecond),
+		WithBreakerHalfOpenRequests(1),
+	)
+	if err != nil {
+		t.Fatalf("New() = %v, want %v", err, nil)
+	}
+	t.Cleanup(p.Close)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.Get(ctx); !errors.Is(err, ErrDial) {
+			t.Fatalf("p.Get() = %v, want %v", err, ErrDial)
+		}
+	}
+	if _, err := p.Get(ctx); err != ErrCircuitOpen {
+		t.Fatalf("p.Get() = %v, want %v", err, ErrCircuitOpen)
+	}
+	if stats := p.Stats(); stats.BreakerState != BreakerOpen || stats.BreakerOpens != 1 || stats.BreakerRejected != 1 {
+		t.Errorf("p.Stats() = %+v, want BreakerState: open, BreakerOpens: 1, BreakerRejected: 1", stats)
+	}
+
+	down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+
+	trial, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("trial p.Get() = %v, want %v", err, nil)
+	}
+	if _, err := p.Get(ctx); err != ErrCircuitOpen {
+		t.Errorf("p.Get() during trial = %v, want %v", err, ErrCircuitOpen)
+	}
+
+	p.Put(trial)
+
+	if stats := p.Stats(); stats.BreakerState != BreakerClosed {
+		t.Errorf("p.Stats().BreakerState = %v, want %v", stats.BreakerState, BreakerClosed)
+	}
+}
+
+func TestCircuitBreakerStaleResults(t *testing.T) {
+	p := newTestPool(t,
+		WithBreakerFailureRatio(0.5),
+		WithBreakerMinRequests(2),
+		WithBreakerOpenTimeout(50*time.Millisecond),
+		WithBreakerHalfOpenRequests(1),
+	)
+	ctx := context.Background()
+
+	// stale resources are borrowed before the breaker opens
+	var stale []*Resource[net.Conn]
+	for i := 0; i < 2; i++ {
+		c, err := p.Get(ctx)
+		if err != nil {
+			t.Fatalf("p.Get() = %v, want %v", err, nil)
+		}
+		stale = append(stale, c)
+	}
+	for i := 0; i < 2; i++ {
+		c, err := p.Get(ctx)
+		if err != nil {
+			t.Fatalf("p.Get() = %v, want %v", err, nil)
+		}
+		p.Discard(c)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	trial, err := p.Get(ctx)
+	if err != nil {
+		t.Fatalf("trial p.Get() = %v, want %v", err, nil)
+	}
+
+	// results of stale resources are not counted as the trial results
+	p.Put(stale[0])
+	p.Discard(stale[1])
+	if stats := p.Stats(); stats.BreakerState != BreakerHalfOpen || stats.BreakerOpens != 1 {
+		t.Errorf("p.Stats() = %+v, want BreakerState: half-open, BreakerOpens: 1", stats)
+	}
+
+	p.Put(trial)
+	if stats := p.Stats(); stats.BreakerState != BreakerClosed {
+		t.Errorf("p.Stats().BreakerState = %v, want %v", stats.BreakerState, BreakerClosed)
+	}
+}
+
+func TestCircuitBreakerDiscard(t *testing.T) {
+	p := newTestPool(t, WithBreakerFailureRatio(0.5), WithBreakerMinRequests(2))
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		c, err := p.Get(ctx)
+		if err != nil {
+			t.Fatalf("p.Get() = %v, want %v", err, nil)
+		}
+		p.Discard(c)
+	}
+
+	if _, err := p.Get(ctx); err != ErrCircuitOpen {
+		t.Errorf("p.Get() = %v, want %v", err, ErrCircuitOpen)
+	}
+	if stats := p.Stats(); stats.OpenConns != 0 || stats.BreakerState != BreakerOpen {
+		t.Errorf("p.Stats() = %+v, want OpenConns: 0, BreakerState: open", stats)
+	}
+}
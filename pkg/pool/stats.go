@@ -0,0 +1,79 @@
+package pool
+
+import "time"
+
+// PoolStats is a snapshot of the pool state and counters since the pool creation
+type PoolStats struct {
+	MaxOpenConns int
+	MaxIdleConns int
+
+	OpenConns int
+	InUse     int
+	Idle      int
+	Waiters   int
+
+	// WaitCount is the total number of requests which waited for a resource
+	WaitCount    uint64
+	WaitDuration time.Duration
+
+	Dials      uint64
+	DialErrors uint64
+	Timeouts   uint64
+	Cancels    uint64
+	// Exhausted is the number of requests rejected because the wait queue was full
+	Exhausted uint64
+
+	HealthCheckFailures uint64
+	MaxIdleClosed       uint64
+	MaxIdleTimeClosed   uint64
+	MaxLifetimeClosed   uint64
+
+	BreakerState BreakerState
+	// BreakerOpens is the number of times the circuit breaker opened
+	BreakerOpens uint64
+	// BreakerRejected is the number of requests rejected by the open circuit breaker
+	BreakerRejected uint64
+}
+
+type counters struct {
+	waitCount           uint64
+	waitDuration        time.Duration
+	dials               uint64
+	dialErrors          uint64
+	timeouts            uint64
+	cancels             uint64
+	exhausted           uint64
+	healthCheckFailures uint64
+	maxIdleClosed       uint64
+	maxIdleTimeClosed   uint64
+	maxLifetimeClosed   uint64
+}
+
+// Stats returns pool statistics
+func (p *Pool[T]) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return PoolStats{
+		MaxOpenConns:        p.maxOpenConns,
+		MaxIdleConns:        p.maxIdleConns,
+		OpenConns:           p.openConns,
+		InUse:               p.openConns - len(p.idleConns),
+		Idle:                len(p.idleConns),
+		Waiters:             p.waiters.Len(),
+		WaitCount:           p.counters.waitCount,
+		WaitDuration:        p.counters.waitDuration,
+		Dials:               p.counters.dials,
+		DialErrors:          p.counters.dialErrors,
+		Timeouts:            p.counters.timeouts,
+		Cancels:             p.counters.cancels,
+		Exhausted:           p.counters.exhausted,
+		HealthCheckFailures: p.counters.healthCheckFailures,
+		MaxIdleClosed:       p.counters.maxIdleClosed,
+		MaxIdleTimeClosed:   p.counters.maxIdleTimeClosed,
+		MaxLifetimeClosed:   p.counters.maxLifetimeClosed,
+		BreakerState:        p.breaker.state,
+		BreakerOpens:        p.breaker.opens,
+		BreakerRejected:     p.breaker.rejected,
+	}
+}